@@ -0,0 +1,167 @@
+package llog
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// levelState is the body of the level handler responses and change requests
+type levelState struct {
+	Level   *Level  `json:"level,omitempty"`
+	VModule *string `json:"vmodule,omitempty"`
+	// Revert the change after this duration, e.g. "15m"
+	Duration string `json:"duration,omitempty"`
+	// Time of the pending revert in responses
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+type levelHandler struct {
+	mu         sync.Mutex
+	timer      *time.Timer // pending revert
+	generation int         // identifies the pending revert, so a replaced timer firing late does nothing
+	revert     struct {
+		level    Level
+		vmodule  string
+		deadline time.Time
+	}
+}
+
+// Return a handler reporting the level and vmodule overrides on GET and changing them on PUT or POST,
+// with a JSON body like {"level":"debug","vmodule":"db/*=trace","duration":"15m"} or the same form values.
+// With a duration the previous settings are restored automatically once it expired,
+// later changes without a duration make the settings permanent.
+// The handler has no authentication, it should only be reachable from trusted networks.
+func LevelHandler() http.Handler {
+	return &levelHandler{}
+}
+
+func (h *levelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut, http.MethodPost:
+		change, err := parseLevelChange(r)
+		if err == nil {
+			err = h.apply(change)
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.state())
+}
+
+func parseLevelChange(r *http.Request) (levelState, error) {
+	var change levelState
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType == "application/json" {
+		if err := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<16)).Decode(&change); err != nil {
+			return change, err
+		}
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return change, err
+		}
+		if r.Form.Has("level") {
+			level, err := ParseLevel(r.Form.Get("level"))
+			if err != nil {
+				return change, err
+			}
+			change.Level = &level
+		}
+		if r.Form.Has("vmodule") {
+			vmodule := r.Form.Get("vmodule")
+			change.VModule = &vmodule
+		}
+		change.Duration = r.Form.Get("duration")
+	}
+
+	if change.Level == nil && change.VModule == nil {
+		return change, errors.New("level or vmodule required")
+	}
+	return change, nil
+}
+
+func (h *levelHandler) apply(change levelState) error {
+	var duration time.Duration
+	if change.Duration != "" {
+		var err error
+		if duration, err = time.ParseDuration(change.Duration); err != nil {
+			return err
+		}
+		if duration <= 0 {
+			return errors.New("duration must be positive")
+		}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	previousLevel, previousVModule := GetLogLevel(), VModule()
+	if change.VModule != nil {
+		if err := SetVModule(*change.VModule); err != nil {
+			return err
+		}
+	}
+	if change.Level != nil {
+		SetLogLevel(*change.Level)
+	}
+
+	if duration == 0 {
+		// permanent change, a pending revert would undo it
+		if h.timer != nil {
+			h.timer.Stop()
+			h.timer = nil
+		}
+		Notice("Log level changed to %s, vmodule %q", GetLogLevel(), VModule())
+		return nil
+	}
+
+	// Revert to the settings before the first of consecutive temporary changes
+	if h.timer == nil {
+		h.revert.level, h.revert.vmodule = previousLevel, previousVModule
+	} else {
+		h.timer.Stop()
+	}
+	h.revert.deadline = time.Now().Add(duration)
+	h.generation++
+	generation := h.generation
+	h.timer = time.AfterFunc(duration, func() { h.expire(generation) })
+	Notice("Log level changed to %s, vmodule %q for %s", GetLogLevel(), VModule(), duration)
+	return nil
+}
+
+func (h *levelHandler) expire(generation int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.timer == nil || h.generation != generation {
+		// replaced by a later change
+		return
+	}
+	h.timer = nil
+	SetVModule(h.revert.vmodule)
+	SetLogLevel(h.revert.level)
+	Notice("Log level reverted to %s, vmodule %q", GetLogLevel(), VModule())
+}
+
+func (h *levelHandler) state() levelState {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	level, vmodule := GetLogLevel(), VModule()
+	state := levelState{Level: &level, VModule: &vmodule}
+	if h.timer != nil {
+		deadline := h.revert.deadline
+		state.RevertAt = &deadline
+	}
+	return state
+}
@@ -0,0 +1,106 @@
+package llog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLevelHandler(t *testing.T) {
+	SetLogLevel(LevelInfo)
+	defer SetLogLevel(LevelDebug)
+	defer SetVModule("")
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	handler := LevelHandler()
+
+	do := func(request *http.Request) (*httptest.ResponseRecorder, map[string]any) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		var state map[string]any
+		if recorder.Code == http.StatusOK {
+			if err := json.Unmarshal(recorder.Body.Bytes(), &state); err != nil {
+				t.Fatalf("invalid response %q: %v", recorder.Body.String(), err)
+			}
+		}
+		return recorder, state
+	}
+	form := func(values url.Values) *http.Request {
+		request := httptest.NewRequest(http.MethodPost, "/level", strings.NewReader(values.Encode()))
+		request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return request
+	}
+
+	_, state := do(httptest.NewRequest(http.MethodGet, "/level", nil))
+	if state["level"] != "Info" || state["vmodule"] != "" || state["revert_at"] != nil {
+		t.Errorf("unexpected state %v", state)
+	}
+
+	request := httptest.NewRequest(http.MethodPut, "/level", strings.NewReader(`{"level":"notice","vmodule":"db/*=trace"}`))
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+	_, state = do(request)
+	if GetLogLevel() != LevelNotice || VModule() != "db/*=trace" || state["level"] != "Notice" || state["vmodule"] != "db/*=trace" {
+		t.Errorf("change not applied: %v", state)
+	}
+	if !strings.Contains(buf.String(), `Log level changed to Notice, vmodule "db/*=trace"`) {
+		t.Errorf("change not logged: %q", buf.String())
+	}
+
+	// Temporary changes revert to the settings before the first of them
+	do(form(url.Values{"level": {"debug"}, "vmodule": {""}, "duration": {"1h"}}))
+	_, state = do(form(url.Values{"level": {"trace"}, "duration": {"50ms"}}))
+	if GetLogLevel() != LevelTrace || state["revert_at"] == nil {
+		t.Errorf("temporary change not applied: %v", state)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for GetLogLevel() != LevelNotice && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, state = do(httptest.NewRequest(http.MethodGet, "/level", nil))
+	if state["level"] != "Notice" || state["vmodule"] != "db/*=trace" || state["revert_at"] != nil {
+		t.Errorf("not reverted: %v", state)
+	}
+
+	// A permanent change cancels the pending revert
+	do(form(url.Values{"level": {"debug"}, "duration": {"50ms"}}))
+	_, state = do(httptest.NewRequest(http.MethodPost, "/level?level=error", nil))
+	if state["level"] != "Error" || state["revert_at"] != nil {
+		t.Errorf("unexpected state %v", state)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if GetLogLevel() != LevelError {
+		t.Errorf("permanent change reverted to %v", GetLogLevel())
+	}
+
+	for _, request := range []*http.Request{
+		form(url.Values{"level": {"loud"}}),
+		form(url.Values{"level": {"info"}, "duration": {"soon"}}),
+		form(url.Values{"level": {"info"}, "duration": {"-1m"}}),
+		form(url.Values{"vmodule": {"db"}}),
+		form(url.Values{}),
+	} {
+		if recorder, _ := do(request); recorder.Code != http.StatusBadRequest {
+			t.Errorf("%s %s: expected bad request, got %d", request.Method, request.URL, recorder.Code)
+		}
+	}
+	request = httptest.NewRequest(http.MethodPut, "/level", strings.NewReader(`{"level":"loud"}`))
+	request.Header.Set("Content-Type", "application/json")
+	if recorder, _ := do(request); recorder.Code != http.StatusBadRequest {
+		t.Errorf("expected bad request for invalid json level, got %d", recorder.Code)
+	}
+	if GetLogLevel() != LevelError || VModule() != "db/*=trace" {
+		t.Errorf("invalid requests changed the settings: %v, %q", GetLogLevel(), VModule())
+	}
+
+	recorder, _ := do(httptest.NewRequest(http.MethodDelete, "/level", nil))
+	if recorder.Code != http.StatusMethodNotAllowed || recorder.Header().Get("Allow") == "" {
+		t.Errorf("unexpected response %d, %v", recorder.Code, recorder.Header())
+	}
+}
@@ -0,0 +1,123 @@
+package llog
+
+import (
+	"sync"
+	"time"
+)
+
+// batcher buffers records of a sink and hands them to send in batches from a background goroutine.
+// send returns the records of the batch that were not delivered, these stay buffered for the next attempt.
+type batcher struct {
+	owner     Sink
+	size      int
+	interval  time.Duration
+	maxBuffer int
+	send      func(batch []Record) ([]Record, error)
+
+	mu      sync.Mutex // guards pending
+	pending []Record
+
+	sendMu sync.Mutex // serializes send
+
+	flushNow chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+func newBatcher(owner Sink, size int, interval time.Duration, maxBuffer int, send func([]Record) ([]Record, error)) *batcher {
+	b := &batcher{
+		owner:     owner,
+		size:      size,
+		interval:  interval,
+		maxBuffer: maxBuffer,
+		send:      send,
+		flushNow:  make(chan struct{}, 1),
+		done:      make(chan struct{}),
+	}
+	b.wg.Add(1)
+	go b.run()
+	return b
+}
+
+func (b *batcher) add(r Record) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(b.pending, r)
+	if over := len(b.pending) - b.maxBuffer; over > 0 {
+		b.pending = b.pending[over:]
+	}
+	if len(b.pending) >= b.size {
+		select {
+		case b.flushNow <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (b *batcher) flush() error {
+	b.sendMu.Lock()
+	defer b.sendMu.Unlock()
+
+	for {
+		b.mu.Lock()
+		n := min(len(b.pending), b.size)
+		batch := b.pending[:n:n]
+		b.pending = b.pending[n:]
+		b.mu.Unlock()
+		if len(batch) == 0 {
+			return nil
+		}
+
+		unsent, err := b.send(batch)
+		if len(unsent) > 0 {
+			b.requeue(unsent)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// requeue puts unsent records back in front of the buffer
+func (b *batcher) requeue(records []Record) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.pending = append(records[:len(records):len(records)], b.pending...)
+	if over := len(b.pending) - b.maxBuffer; over > 0 {
+		b.pending = b.pending[over:]
+	}
+}
+
+// stop ends the background goroutine and sends the remaining records.
+// It reports true only for the first call.
+func (b *batcher) stop() (bool, error) {
+	first := false
+	b.stopOnce.Do(func() {
+		first = true
+		close(b.done)
+	})
+	if !first {
+		return false, nil
+	}
+	b.wg.Wait()
+	return true, b.flush()
+}
+
+func (b *batcher) run() {
+	defer b.wg.Done()
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-b.done:
+			return
+		case <-ticker.C:
+		case <-b.flushNow:
+		}
+		if err := b.flush(); err != nil {
+			reportSinkError(b.owner, err)
+		}
+	}
+}
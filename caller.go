@@ -0,0 +1,145 @@
+package llog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// CallerPath selects how the file of the caller is shown
+type CallerPath int
+
+const (
+	// Relative to the working directory, absolute for files outside of it
+	CallerPathRelative CallerPath = iota
+	// File name only, e.g. "query.go"
+	CallerPathShort
+	// Absolute path as recorded at build time
+	CallerPathFull
+	// Import path of the package followed by the file name, e.g. "github.com/user/app/db/query.go".
+	// Stays the same wherever the binary runs.
+	CallerPathModule
+)
+
+type CallerOptions struct {
+	// Path of the caller's file, defaults to CallerPathRelative
+	Path CallerPath
+	// Add the function name after the location, e.g. "query.go:42 db.(*Store).Query"
+	Function bool
+}
+
+var callerOptions atomic.Pointer[CallerOptions]
+
+// Functions marked by Helper, skipped when looking up the caller
+var helpers sync.Map
+var helperCount atomic.Int32
+
+// Set how the caller is reported in the console and the records of the sinks
+func SetCaller(opts CallerOptions) {
+	callerOptions.Store(&opts)
+}
+
+// Show the caller location of a level in the console or not, e.g. to add it to Info or drop it from Warn
+func SetLevelCaller(level Level, enabled bool) error {
+	definition, ok := GetLevelDefinition(level)
+	if !ok {
+		return errorNotRegistered(level)
+	}
+	definition.Location = enabled
+	return RegisterLevel(level, definition)
+}
+
+func errorNotRegistered(level Level) error {
+	return errors.New("level " + level.String() + " is not registered")
+}
+
+// Mark the calling function as logging helper like testing.T.Helper.
+// Records logged from it report the location of its caller instead.
+func Helper() {
+	var pcs [1]uintptr
+	if runtime.Callers(2, pcs[:]) == 0 {
+		return
+	}
+	frame, _ := runtime.CallersFrames(pcs[:]).Next()
+	if _, loaded := helpers.LoadOrStore(frame.Function, struct{}{}); !loaded {
+		helperCount.Add(1)
+	}
+}
+
+// Return a logger reporting the caller skip frames further up, for wrappers around the package functions
+func CallerSkip(skip int) *Logger {
+	return &Logger{skip: skip}
+}
+
+// callerFrame returns the frame skip frames above its caller, continuing past functions marked with Helper
+func callerFrame(skip int) runtime.Frame {
+	var pcs [32]uintptr
+	n := 1
+	if helperCount.Load() > 0 {
+		n = len(pcs)
+	}
+	n = runtime.Callers(skip+2, pcs[:n])
+	frames := runtime.CallersFrames(pcs[:n])
+	for {
+		frame, more := frames.Next()
+		if !more {
+			return frame
+		}
+		if _, helper := helpers.Load(frame.Function); !helper {
+			return frame
+		}
+	}
+}
+
+// callerLoc returns the file, line and, if enabled, function of the caller skip frames above it
+func callerLoc(skip int) (file string, line int, function string) {
+	frame := callerFrame(skip + 1)
+	opts := currentCallerOptions()
+	if opts.Function {
+		function = shortFunctionName(frame.Function)
+	}
+	return callerFile(frame, opts.Path), frame.Line, function
+}
+
+func currentCallerOptions() CallerOptions {
+	if opts := callerOptions.Load(); opts != nil {
+		return *opts
+	}
+	return CallerOptions{}
+}
+
+// callerFile returns the file of frame in the given path mode
+func callerFile(frame runtime.Frame, mode CallerPath) string {
+	switch mode {
+	case CallerPathRelative:
+		cwd, _ := os.Getwd()
+		return strings.TrimPrefix(frame.File, cwd+"/")
+	case CallerPathShort:
+		return filepath.Base(frame.File)
+	case CallerPathModule:
+		if pkg := functionPackage(frame.Function); pkg != "" {
+			return pkg + "/" + filepath.Base(frame.File)
+		}
+	}
+	return frame.File
+}
+
+// functionPackage returns the import path of a function name like "github.com/user/app/db.(*Store).Query"
+func functionPackage(function string) string {
+	slash := strings.LastIndex(function, "/")
+	dot := strings.Index(function[slash+1:], ".")
+	if dot < 0 {
+		return ""
+	}
+	// dots in the last path element are escaped in symbol names, e.g. "gopkg.in/yaml%2ev3"
+	return strings.ReplaceAll(function[:slash+1+dot], "%2e", ".")
+}
+
+// shortFunctionName drops the directories of the import path, e.g. "db.(*Store).Query"
+func shortFunctionName(function string) string {
+	return strings.ReplaceAll(function[strings.LastIndex(function, "/")+1:], "%2e", ".")
+}
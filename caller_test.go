@@ -0,0 +1,163 @@
+package llog
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// logThroughHelper is a wrapper marked as helper, its records report the caller
+func logThroughHelper(msg string) {
+	Helper()
+	Warn(msg)
+}
+
+// logThroughWrapper skips its own frame explicitly
+func logThroughWrapper(msg string) {
+	CallerSkip(1).Warn(msg)
+}
+
+func currentLine() int {
+	_, _, line, _ := runtime.Caller(1)
+	return line
+}
+
+func TestCallerSkip(t *testing.T) {
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	expected := []string{}
+	logThroughHelper("helper")
+	expected = append(expected, "caller_test.go:"+strconv.Itoa(currentLine()-1))
+	logThroughHelper("helper again")
+	expected = append(expected, "caller_test.go:"+strconv.Itoa(currentLine()-1))
+	logThroughWrapper("wrapper")
+	expected = append(expected, "caller_test.go:"+strconv.Itoa(currentLine()-1))
+	logger := FromContext(context.Background()).With("user", "ada").CallerSkip(1)
+	func() { logger.Warn("closure") }()
+	expected = append(expected, "caller_test.go:"+strconv.Itoa(currentLine()-1))
+	// The skip is kept by derived loggers
+	func() { logger.With("id", 1).Log(LevelError, "derived") }()
+	expected = append(expected, "caller_test.go:"+strconv.Itoa(currentLine()-1))
+
+	records := sink.snapshot()
+	if len(records) != len(expected) {
+		t.Fatalf("expected %d records, got %d", len(expected), len(records))
+	}
+	for i, record := range records {
+		if location := record.File + ":" + strconv.Itoa(record.Line); location != expected[i] {
+			t.Errorf("%s: expected %s, got %s", record.Message, expected[i], location)
+		}
+	}
+
+	// vmodule overrides apply to the caller of the helper
+	SetLogLevel(LevelError)
+	defer SetLogLevel(LevelDebug)
+	SetVModule("caller_test=warn")
+	defer SetVModule("")
+	logThroughHelper("shown by override")
+	if records := sink.snapshot(); records[len(records)-1].Message != "shown by override" {
+		t.Error("vmodule override not applied to the helper's caller")
+	}
+}
+
+func TestCallerOptions(t *testing.T) {
+	defer SetCaller(CallerOptions{})
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	for _, test := range []struct {
+		opts     CallerOptions
+		expected func(file string) bool
+	}{
+		{CallerOptions{}, func(file string) bool { return file == "caller_test.go" }},
+		{CallerOptions{Path: CallerPathShort}, func(file string) bool { return file == "caller_test.go" }},
+		{CallerOptions{Path: CallerPathFull}, func(file string) bool {
+			return filepath.IsAbs(file) && strings.HasSuffix(file, "/caller_test.go")
+		}},
+		{CallerOptions{Path: CallerPathModule}, func(file string) bool {
+			return file == "github.com/blockyblockling/llog/caller_test.go"
+		}},
+	} {
+		SetCaller(test.opts)
+		buf.Reset()
+		Warn("location")
+		record := sink.snapshot()[len(sink.snapshot())-1]
+		if !test.expected(record.File) || record.Function != "" {
+			t.Errorf("%+v: unexpected record location %q %q", test.opts, record.File, record.Function)
+		}
+		if !strings.Contains(buf.String(), record.File+":"+strconv.Itoa(record.Line)+reset) {
+			t.Errorf("%+v: unexpected console output %q", test.opts, buf.String())
+		}
+	}
+
+	SetCaller(CallerOptions{Path: CallerPathShort, Function: true})
+	buf.Reset()
+	Error("with function")
+	record := sink.snapshot()[len(sink.snapshot())-1]
+	if record.Function != "llog.TestCallerOptions" {
+		t.Errorf("unexpected function %q", record.Function)
+	}
+	if !strings.Contains(buf.String(), "caller_test.go:"+strconv.Itoa(record.Line)+" llog.TestCallerOptions"+reset) {
+		t.Errorf("unexpected console output %q", buf.String())
+	}
+	if line, _ := TextEncoder(record); !strings.Contains(string(line), " ERR caller_test.go:"+strconv.Itoa(record.Line)+" llog.TestCallerOptions with function") {
+		t.Errorf("unexpected text %s", line)
+	}
+	if line, _ := JSONEncoder(record); !strings.Contains(string(line), `"function":"llog.TestCallerOptions"`) {
+		t.Errorf("unexpected json %s", line)
+	}
+}
+
+func TestSetLevelCaller(t *testing.T) {
+	saved := levels.Load()
+	defer levels.Store(saved)
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	if err := SetLevelCaller(LevelInfo, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLevelCaller(LevelWarn, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLevelCaller(Level(99), true); err == nil {
+		t.Error("expected error for unregistered level")
+	}
+	Info("with caller")
+	Warn("without caller")
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.Contains(lines[0], "caller_test.go:") || strings.Contains(lines[1], "caller_test.go:") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestFunctionNames(t *testing.T) {
+	for function, expected := range map[string][2]string{
+		"main.main":                             {"main", "main.main"},
+		"github.com/user/app/db.(*Store).Query": {"github.com/user/app/db", "db.(*Store).Query"},
+		"gopkg.in/yaml%2ev3.Unmarshal":          {"gopkg.in/yaml.v3", "yaml.v3.Unmarshal"},
+		"github.com/user/app.run.func1":         {"github.com/user/app", "app.run.func1"},
+		"":                                      {"", ""},
+	} {
+		if pkg := functionPackage(function); pkg != expected[0] {
+			t.Errorf("%q: expected package %q, got %q", function, expected[0], pkg)
+		}
+		if name := shortFunctionName(function); name != expected[1] {
+			t.Errorf("%q: expected name %q, got %q", function, expected[1], name)
+		}
+	}
+}
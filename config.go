@@ -0,0 +1,503 @@
+package llog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fsnotify/fsnotify"
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of the environment variables overriding the configuration file
+const configEnvPrefix = "LLOG_"
+
+// Config describes the logger setup as read by LoadConfig from YAML, JSON or TOML.
+// Every key can be overridden by an environment variable named after its path, e.g.
+// LLOG_LEVEL, LLOG_NOTIFY_MAIL_HOST or LLOG_OUTPUTS_0_PATH for the first output.
+// Outputs missing in the file are added, e.g. by LLOG_OUTPUTS_0_TYPE and LLOG_OUTPUTS_0_PATH.
+// Lists of strings are comma separated. Settings whose key is missing keep their current value.
+type Config struct {
+	// Level name or alias, empty keeps the current level
+	Level string `json:"level" yaml:"level" toml:"level"`
+	// Per file and package overrides as accepted by SetVModule
+	VModule *string `json:"vmodule" yaml:"vmodule" toml:"vmodule"`
+	// Colored console output, unset keeps the current setting
+	Colors *bool `json:"colors" yaml:"colors" toml:"colors"`
+	// Console timestamps, see TimestampOptions. The layout is a time.Format layout or
+	// unix, unixmilli, unixmicro, unixnano or elapsed, empty uses the default.
+	TimestampFormat *string `json:"timestamp_format" yaml:"timestamp_format" toml:"timestamp_format"`
+	TimestampUTC    *bool   `json:"timestamp_utc" yaml:"timestamp_utc" toml:"timestamp_utc"`
+	TimestampOmit   *bool   `json:"timestamp_omit" yaml:"timestamp_omit" toml:"timestamp_omit"`
+	// Caller path mode relative, short, full or module, empty uses relative
+	CallerPath *string `json:"caller_path" yaml:"caller_path" toml:"caller_path"`
+	// Add the function name to the caller location
+	CallerFunction *bool `json:"caller_function" yaml:"caller_function" toml:"caller_function"`
+	// Capture stack traces for Error, Critical and Fatal records
+	StackTraces *bool `json:"stack_traces" yaml:"stack_traces" toml:"stack_traces"`
+	// Sinks replacing the ones of the previously loaded configuration, an empty list removes them
+	Outputs *[]OutputConfig `json:"outputs" yaml:"outputs" toml:"outputs"`
+	Notify  NotifyConfig    `json:"notify" yaml:"notify" toml:"notify"`
+}
+
+// OutputConfig describes a sink. Only the keys of its type are used.
+type OutputConfig struct {
+	// file, socket, gelf, fluent, splunk or kafka
+	Type string `json:"type" yaml:"type" toml:"type"`
+	// json or text for file and socket outputs
+	Encoder string `json:"encoder" yaml:"encoder" toml:"encoder"`
+	// Timestamps of the encoder like the console timestamp keys
+	TimestampFormat string `json:"timestamp_format" yaml:"timestamp_format" toml:"timestamp_format"`
+	TimestampUTC    bool   `json:"timestamp_utc" yaml:"timestamp_utc" toml:"timestamp_utc"`
+	TimestampOmit   bool   `json:"timestamp_omit" yaml:"timestamp_omit" toml:"timestamp_omit"`
+	// file
+	Path string `json:"path" yaml:"path" toml:"path"`
+	// socket, gelf and fluent
+	Network string `json:"network" yaml:"network" toml:"network"`
+	Address string `json:"address" yaml:"address" toml:"address"`
+	// fluent
+	Tag string `json:"tag" yaml:"tag" toml:"tag"`
+	// splunk
+	URL   string `json:"url" yaml:"url" toml:"url"`
+	Token string `json:"token" yaml:"token" toml:"token"`
+	Index string `json:"index" yaml:"index" toml:"index"`
+	// kafka
+	Brokers []string `json:"brokers" yaml:"brokers" toml:"brokers"`
+	Topic   string   `json:"topic" yaml:"topic" toml:"topic"`
+	// Additional fields of gelf, fluent, splunk and kafka outputs
+	Fields map[string]any `json:"fields" yaml:"fields" toml:"fields"`
+}
+
+type NotifyConfig struct {
+	// Passed to InitMail if Host is set
+	Mail MailConfig `json:"mail" yaml:"mail" toml:"mail"`
+}
+
+type MailConfig struct {
+	From     string   `json:"from" yaml:"from" toml:"from"`
+	To       []string `json:"to" yaml:"to" toml:"to"`
+	Host     string   `json:"host" yaml:"host" toml:"host"`
+	Port     int      `json:"port" yaml:"port" toml:"port"`
+	User     string   `json:"user" yaml:"user" toml:"user"`
+	Password string   `json:"password" yaml:"password" toml:"password"`
+	// Defaults to "LLog Notification!"
+	Subject string `json:"subject" yaml:"subject" toml:"subject"`
+}
+
+// Sinks created by the last applied configuration, replaced on reload
+var configMu sync.Mutex
+var configSinks []Sink
+
+// Read the configuration at path, apply the LLOG_* environment overrides and apply it
+func LoadConfig(path string) error {
+	config, err := ReadConfig(path)
+	if err != nil {
+		return err
+	}
+	return config.Apply()
+}
+
+// Read the configuration at path with the LLOG_* environment overrides applied.
+// The format is chosen by the extension: .yaml, .yml, .json or .toml. Unknown keys are errors.
+func ReadConfig(path string) (*Config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	var config Config
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&config); err != nil && !errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&config); err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+	case ".toml":
+		metadata, err := toml.Decode(string(data), &config)
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %w", path, err)
+		}
+		if undecoded := metadata.Undecoded(); len(undecoded) > 0 {
+			return nil, fmt.Errorf("config %s: %s: unknown key", path, undecoded[0])
+		}
+	default:
+		return nil, fmt.Errorf("config %s: unsupported format %q", path, filepath.Ext(path))
+	}
+
+	if err := applyConfigEnv(reflect.ValueOf(&config).Elem(), configEnvPrefix, ""); err != nil {
+		return nil, fmt.Errorf("config %s: %w", path, err)
+	}
+	return &config, nil
+}
+
+// applyConfigEnv overrides the fields of v from the environment variables named prefix + the field path
+func applyConfigEnv(v reflect.Value, prefix string, key string) error {
+	switch v.Kind() {
+	case reflect.Struct:
+		for i := range v.NumField() {
+			name, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			if err := applyConfigEnv(v.Field(i), prefix+strings.ToUpper(name)+"_", joinConfigKey(key, name)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Struct {
+			for configEnvHasPrefix(prefix + strconv.Itoa(v.Len()) + "_") {
+				v.Set(reflect.Append(v, reflect.Zero(v.Type().Elem())))
+			}
+			for i := range v.Len() {
+				if err := applyConfigEnv(v.Index(i), prefix+strconv.Itoa(i)+"_", fmt.Sprintf("%s[%d]", key, i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		return nil
+	case reflect.Pointer:
+		if v.Type().Elem().Kind() == reflect.Slice {
+			// lists missing in the file are created by their first element, e.g. LLOG_OUTPUTS_0_TYPE
+			if v.IsNil() {
+				if !configEnvHasPrefix(prefix + "0_") {
+					return nil
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			return applyConfigEnv(v.Elem(), prefix, key)
+		}
+	}
+
+	value, ok := os.LookupEnv(strings.TrimSuffix(prefix, "_"))
+	if !ok {
+		return nil
+	}
+	if v.Kind() == reflect.Pointer {
+		// optional keys are nil until set
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid number %q", key, value)
+		}
+		v.SetInt(int64(n))
+	case reflect.Bool:
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("%s: invalid boolean %q", key, value)
+		}
+		v.SetBool(enabled)
+	case reflect.Slice:
+		var values []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				values = append(values, item)
+			}
+		}
+		v.Set(reflect.ValueOf(values))
+	}
+	return nil
+}
+
+// configEnvHasPrefix reports whether any environment variable starts with prefix
+func configEnvHasPrefix(prefix string) bool {
+	for _, entry := range os.Environ() {
+		if strings.HasPrefix(entry, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func joinConfigKey(parent string, name string) string {
+	if parent == "" {
+		return name
+	}
+	return parent + "." + name
+}
+
+// Apply the configuration. Everything is validated first, on errors nothing is changed.
+// Missing keys keep the current settings, e.g. those changed by the admin handler.
+// The sinks of the previously applied configuration are closed, other sinks stay registered.
+func (c *Config) Apply() error {
+	level := GetLogLevel()
+	if c.Level != "" {
+		var err error
+		if level, err = ParseLevel(c.Level); err != nil {
+			return fmt.Errorf("config: level: %w", err)
+		}
+	}
+	var vmoduleState *vmoduleState
+	if c.VModule != nil {
+		var err error
+		if vmoduleState, err = parseVModule(*c.VModule); err != nil {
+			return fmt.Errorf("config: %w", err)
+		}
+	}
+	caller := currentCallerOptions()
+	if c.CallerPath != nil {
+		callerPaths := map[string]CallerPath{"": CallerPathRelative, "relative": CallerPathRelative,
+			"short": CallerPathShort, "full": CallerPathFull, "module": CallerPathModule}
+		var ok bool
+		if caller.Path, ok = callerPaths[*c.CallerPath]; !ok {
+			return fmt.Errorf("config: caller_path: unknown mode %q", *c.CallerPath)
+		}
+	}
+	mail := c.Notify.Mail
+	if mail.Host != "" && (mail.From == "" || len(mail.To) == 0) {
+		return errors.New("config: notify.mail: from and to are required")
+	}
+	if mail.Host != "" && mail.Port == 0 {
+		return errors.New("config: notify.mail.port: required with host")
+	}
+
+	var outputs []Sink
+	closeOutputs := func() {
+		for _, s := range outputs {
+			if closer, ok := s.(io.Closer); ok {
+				closer.Close()
+			}
+		}
+	}
+	for i, output := range c.outputs() {
+		s, err := output.sink()
+		if err != nil {
+			closeOutputs()
+			return fmt.Errorf("config: outputs[%d].%w", i, err)
+		}
+		outputs = append(outputs, s)
+	}
+
+	configMu.Lock()
+	defer configMu.Unlock()
+	SetLogLevel(level)
+	if c.VModule != nil {
+		vmodule.Store(vmoduleState)
+	}
+	if c.Colors != nil {
+		SetColors(*c.Colors)
+	}
+	timestamp := consoleTimestampOptions()
+	setConfigValue(&timestamp.Layout, c.TimestampFormat)
+	setConfigValue(&timestamp.UTC, c.TimestampUTC)
+	setConfigValue(&timestamp.Omit, c.TimestampOmit)
+	SetTimestamp(timestamp)
+	setConfigValue(&caller.Function, c.CallerFunction)
+	SetCaller(caller)
+	if c.StackTraces != nil {
+		SetStackTraces(*c.StackTraces)
+	}
+	if mail.Host != "" {
+		InitMail(mail.From, mail.To, mail.Host, mail.Port, mail.User, mail.Password, mail.Subject)
+	}
+
+	if c.Outputs == nil {
+		return nil
+	}
+	previous := configSinks
+	configSinks = outputs
+	for _, s := range outputs {
+		AddSink(s)
+	}
+	var errs []error
+	for _, s := range previous {
+		RemoveSink(s)
+		if closer, ok := s.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Config) outputs() []OutputConfig {
+	if c.Outputs == nil {
+		return nil
+	}
+	return *c.Outputs
+}
+
+// setConfigValue sets *target to the value of an optional key if it is present
+func setConfigValue[T any](target *T, value *T) {
+	if value != nil {
+		*target = *value
+	}
+}
+
+// sink creates the output, errors start with the offending key
+func (o OutputConfig) sink() (Sink, error) {
+	name := o.Encoder
+	if name == "" {
+		// the defaults of the writers
+		name = "json"
+		if o.Type == "file" {
+			name = "text"
+		}
+	}
+	timestamps := TimestampOptions{Layout: o.TimestampFormat, UTC: o.TimestampUTC, Omit: o.TimestampOmit}
+	var encoder Encoder
+	switch name {
+	case "json":
+		encoder = NewJSONEncoder(timestamps)
+	case "text":
+		encoder = NewTextEncoder(timestamps)
+	default:
+		return nil, fmt.Errorf("encoder: unknown encoder %q", o.Encoder)
+	}
+	required := func(key string, value string) error {
+		if value == "" {
+			return fmt.Errorf("%s: required for %s outputs", key, o.Type)
+		}
+		return nil
+	}
+
+	switch o.Type {
+	case "file":
+		if err := required("path", o.Path); err != nil {
+			return nil, err
+		}
+		w, err := NewFileWriter(o.Path, FileOptions{Encoder: encoder})
+		return w, outputError("path", err)
+	case "socket":
+		if err := required("address", o.Address); err != nil {
+			return nil, err
+		}
+		w, err := NewSocketWriter(o.networkOr("tcp"), o.Address, SocketOptions{Encoder: encoder})
+		return w, outputError("network", err)
+	case "gelf":
+		if err := required("address", o.Address); err != nil {
+			return nil, err
+		}
+		w, err := NewGELFWriter(o.networkOr("udp"), o.Address, GELFOptions{Fields: o.Fields})
+		return w, outputError("network", err)
+	case "fluent":
+		if err := required("address", o.Address); err != nil {
+			return nil, err
+		}
+		w, err := NewFluentWriter(o.networkOr("tcp"), o.Address, FluentOptions{Tag: o.Tag, Fields: o.Fields})
+		return w, outputError("network", err)
+	case "splunk":
+		if err := required("url", o.URL); err != nil {
+			return nil, err
+		}
+		if err := required("token", o.Token); err != nil {
+			return nil, err
+		}
+		w, err := NewSplunkWriter(o.URL, SplunkOptions{Token: o.Token, Index: o.Index, Fields: o.Fields})
+		return w, outputError("url", err)
+	case "kafka":
+		if len(o.Brokers) == 0 {
+			return nil, errors.New("brokers: required for kafka outputs")
+		}
+		if err := required("topic", o.Topic); err != nil {
+			return nil, err
+		}
+		w, err := NewKafkaWriter(o.Brokers, KafkaOptions{Topic: o.Topic, Fields: o.Fields})
+		return w, outputError("brokers", err)
+	case "":
+		return nil, errors.New("type: required")
+	}
+	return nil, fmt.Errorf("type: unknown output type %q", o.Type)
+}
+
+func (o OutputConfig) networkOr(fallback string) string {
+	if o.Network == "" {
+		return fallback
+	}
+	return o.Network
+}
+
+// outputError prefixes errors of the writer constructors with the key most likely at fault
+func outputError(key string, err error) error {
+	if err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+// Load the configuration at path like LoadConfig and load it again whenever the file changes.
+// Failed reloads keep the current configuration and are passed to onError, nil logs them.
+// The returned function stops watching.
+func WatchConfig(path string, onError func(error)) (stop func(), err error) {
+	if err := LoadConfig(path); err != nil {
+		return nil, err
+	}
+	if onError == nil {
+		onError = func(err error) { Error("Reloading configuration failed: %v", err) }
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("config: %w", err)
+	}
+	// Watch the directory, editors and config management replace the file instead of writing to it
+	if err := watcher.Add(filepath.Dir(path)); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("config: %w", err)
+	}
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		// Changes usually arrive as several events, reload once they settled
+		debounce := time.NewTimer(time.Hour)
+		debounce.Stop()
+		defer debounce.Stop()
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if filepath.Clean(event.Name) == filepath.Clean(path) && !event.Has(fsnotify.Chmod) {
+					debounce.Reset(100 * time.Millisecond)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				onError(fmt.Errorf("config: %w", err))
+			case <-debounce.C:
+				if err := LoadConfig(path); err != nil {
+					onError(err)
+				}
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(done)
+			watcher.Close()
+			wg.Wait()
+		})
+	}, nil
+}
@@ -0,0 +1,359 @@
+package llog
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const yamlConfig = `
+level: notice
+vmodule: db/*=trace
+colors: false
+timestamp_format: "15:04:05"
+outputs:
+  - type: file
+    path: %DIR%/app.log
+    encoder: json
+    timestamp_format: unixmilli
+notify:
+  mail:
+    from: app@example.com
+    to: [ops@example.com]
+    host: smtp.example.com
+    port: 587
+    subject: app alert
+`
+
+const jsonConfig = `{
+  "level": "notice",
+  "vmodule": "db/*=trace",
+  "colors": false,
+  "timestamp_format": "15:04:05",
+  "outputs": [{"type": "file", "path": "%DIR%/app.log", "encoder": "json", "timestamp_format": "unixmilli"}],
+  "notify": {"mail": {"from": "app@example.com", "to": ["ops@example.com"], "host": "smtp.example.com", "port": 587, "subject": "app alert"}}
+}`
+
+const tomlConfig = `
+level = "notice"
+vmodule = "db/*=trace"
+colors = false
+timestamp_format = "15:04:05"
+
+[[outputs]]
+type = "file"
+path = "%DIR%/app.log"
+encoder = "json"
+timestamp_format = "unixmilli"
+
+[notify.mail]
+from = "app@example.com"
+to = ["ops@example.com"]
+host = "smtp.example.com"
+port = 587
+subject = "app alert"
+`
+
+func writeConfig(t *testing.T, dir string, name string, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(strings.ReplaceAll(content, "%DIR%", dir)), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// resetConfig closes the sinks of the applied configuration and restores the test defaults
+func resetConfig() {
+	(&Config{Level: "debug", Outputs: &[]OutputConfig{}}).Apply()
+	SetColors(true)
+	SetVModule("")
+	SetTimestamp(TimestampOptions{})
+	SetCaller(CallerOptions{})
+	SetStackTraces(false)
+	mail_from, mail_to, mail_subject = "", nil, ""
+}
+
+func TestReadConfig(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := writeConfig(t, dir, "llog.yaml", yamlConfig)
+	expected, err := ReadConfig(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected.Level != "notice" || len(*expected.Outputs) != 1 || expected.Notify.Mail.Port != 587 || *expected.Colors {
+		t.Errorf("unexpected config %+v", expected)
+	}
+	for name, content := range map[string]string{"llog.json": jsonConfig, "llog.toml": tomlConfig, "llog.yml": yamlConfig} {
+		config, err := ReadConfig(writeConfig(t, dir, name, content))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		} else if !reflect.DeepEqual(config, expected) {
+			t.Errorf("%s: got %+v, expected %+v", name, config, expected)
+		}
+	}
+
+	// Environment overrides
+	t.Setenv("LLOG_LEVEL", "error")
+	t.Setenv("LLOG_COLORS", "true")
+	t.Setenv("LLOG_OUTPUTS_0_ENCODER", "text")
+	t.Setenv("LLOG_OUTPUTS_1_TYPE", "file")
+	t.Setenv("LLOG_OUTPUTS_1_PATH", "/var/log/app.log")
+	t.Setenv("LLOG_OUTPUTS_3_PATH", "ignored")
+	t.Setenv("LLOG_STACK_TRACES", "true")
+	t.Setenv("LLOG_NOTIFY_MAIL_TO", "a@example.com, b@example.com")
+	t.Setenv("LLOG_NOTIFY_MAIL_PORT", "25")
+	t.Setenv("LLOG_OUTPUTS_0_TIMESTAMP_UTC", "1")
+	config, err := ReadConfig(yamlPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outputs := *config.Outputs
+	if config.Level != "error" || !*config.Colors || outputs[0].Encoder != "text" ||
+		strings.Join(config.Notify.Mail.To, ";") != "a@example.com;b@example.com" || config.Notify.Mail.Port != 25 ||
+		!outputs[0].TimestampUTC || !*config.StackTraces || config.CallerPath != nil {
+		t.Errorf("environment not applied: %+v", config)
+	}
+	// Outputs missing in the file are added up to the first gap
+	if len(outputs) != 2 || outputs[1].Type != "file" || outputs[1].Path != "/var/log/app.log" {
+		t.Errorf("output not added by environment: %+v", outputs)
+	}
+	t.Setenv("LLOG_NOTIFY_MAIL_PORT", "smtp")
+	if _, err := ReadConfig(yamlPath); err == nil || !strings.Contains(err.Error(), "notify.mail.port: invalid number") {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	for content, expected := range map[string]string{
+		"levle: info\n":                            "line 1: field levle not found",
+		"outputs:\n  - type: file\n    pth: x\n":   "line 3: field pth not found",
+		"level: loud\n":                            "config: level: Level not found: loud",
+		"caller_path: deep\n":                      `config: caller_path: unknown mode "deep"`,
+		"vmodule: db\n":                            "config: vmodule: expected pattern=level",
+		"outputs:\n  - type: file\n  - type: db\n": "config: outputs[0].path: required for file outputs",
+		"outputs:\n  - type: socket\n    address: x\n    encoder: xml\n": `config: outputs[0].encoder: unknown encoder "xml"`,
+		"outputs:\n  - path: x\n":                                                                          "config: outputs[0].type: required",
+		"outputs:\n  - type: kafka\n    topic: t\n":                                                        "config: outputs[0].brokers: required for kafka outputs",
+		"outputs:\n  - type: gelf\n    address: x\n    network: ip\n":                                      "config: outputs[0].network: gelf: unsupported network ip",
+		"notify:\n  mail:\n    host: smtp.example.com\n":                                                   "config: notify.mail: from and to are required",
+		"notify:\n  mail:\n    host: smtp.example.com\n    from: a@example.com\n    to: [b@example.com]\n": "config: notify.mail.port: required with host",
+	} {
+		err := LoadConfig(writeConfig(t, dir, "llog.yaml", content))
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected error %q, got %v", content, expected, err)
+		}
+	}
+	if err := LoadConfig(writeConfig(t, dir, "llog.toml", "[outputs]\nlevel = 1\n")); err == nil {
+		t.Error("expected toml type error")
+	}
+	if err := LoadConfig(writeConfig(t, dir, "llog.toml", "levle = \"info\"\n")); err == nil || !strings.Contains(err.Error(), "levle: unknown key") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := LoadConfig(writeConfig(t, dir, "llog.json", `{"level": "info", "extra": 1}`)); err == nil || !strings.Contains(err.Error(), `unknown field "extra"`) {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := LoadConfig(writeConfig(t, dir, "llog.ini", "")); err == nil || !strings.Contains(err.Error(), "unsupported format") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := LoadConfig(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected error for missing file")
+	}
+
+	// Nothing was applied
+	if GetLogLevel() != LevelDebug || VModule() != "" || len(configSinks) != 0 {
+		t.Errorf("failed configs applied: %v, %q, %v", GetLogLevel(), VModule(), configSinks)
+	}
+}
+
+func TestConfigKeepsMissingKeys(t *testing.T) {
+	defer resetConfig()
+	SetVModule("http=trace")
+	SetStackTraces(true)
+	SetTimestamp(TimestampOptions{Layout: "15:04", UTC: true})
+	SetCaller(CallerOptions{Path: CallerPathShort, Function: true})
+
+	if err := LoadConfig(writeConfig(t, t.TempDir(), "llog.yaml", "level: info\ntimestamp_omit: true\ncaller_path: full\n")); err != nil {
+		t.Fatal(err)
+	}
+	if VModule() != "http=trace" {
+		t.Errorf("vmodule reset to %q", VModule())
+	}
+	if definition, _ := GetLevelDefinition(LevelError); !definition.Stack {
+		t.Error("stack traces disabled")
+	}
+	if timestamp := consoleTimestampOptions(); timestamp != (TimestampOptions{Layout: "15:04", UTC: true, Omit: true}) {
+		t.Errorf("unexpected timestamp options %+v", timestamp)
+	}
+	if caller := currentCallerOptions(); caller != (CallerOptions{Path: CallerPathFull, Function: true}) {
+		t.Errorf("unexpected caller options %+v", caller)
+	}
+
+	// Keys set to their zero value are applied
+	if err := LoadConfig(writeConfig(t, t.TempDir(), "llog.json", `{"vmodule": "", "stack_traces": false, "timestamp_utc": false}`)); err != nil {
+		t.Fatal(err)
+	}
+	if definition, _ := GetLevelDefinition(LevelError); VModule() != "" || definition.Stack || consoleTimestampOptions().UTC {
+		t.Errorf("explicit keys not applied: %q, %v, %+v", VModule(), definition.Stack, consoleTimestampOptions())
+	}
+}
+
+func TestConfigKeepsOutputs(t *testing.T) {
+	defer resetConfig()
+	stdout = &syncBuffer{}
+	defer func() { stdout = os.Stdout }()
+	dir := t.TempDir()
+	logFile := filepath.Join(dir, "app.log")
+
+	if err := LoadConfig(writeConfig(t, dir, "llog.yaml", "outputs:\n  - type: file\n    path: %DIR%/app.log\n")); err != nil {
+		t.Fatal(err)
+	}
+	// Reloading without outputs key leaves the outputs running
+	if err := LoadConfig(writeConfig(t, dir, "llog.yaml", "level: info\n")); err != nil {
+		t.Fatal(err)
+	}
+	Info("kept")
+	if data, _ := os.ReadFile(logFile); !strings.Contains(string(data), "kept") || len(configSinks) != 1 {
+		t.Errorf("outputs removed by config without outputs: %q, %v", data, configSinks)
+	}
+
+	// An empty list removes them
+	if err := LoadConfig(writeConfig(t, dir, "llog.json", `{"outputs": []}`)); err != nil {
+		t.Fatal(err)
+	}
+	Info("removed")
+	if data, _ := os.ReadFile(logFile); strings.Contains(string(data), "removed") || len(configSinks) != 0 {
+		t.Errorf("outputs not removed: %q, %v", data, configSinks)
+	}
+
+	// The environment adds outputs to files without outputs key
+	t.Setenv("LLOG_OUTPUTS_0_TYPE", "file")
+	t.Setenv("LLOG_OUTPUTS_0_PATH", logFile)
+	config, err := ReadConfig(writeConfig(t, dir, "llog.yaml", "level: info\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.Outputs == nil || len(*config.Outputs) != 1 || (*config.Outputs)[0].Path != logFile {
+		t.Errorf("output not added by environment: %+v", config.Outputs)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	defer resetConfig()
+	var buf syncBuffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	dir := t.TempDir()
+
+	if err := LoadConfig(writeConfig(t, dir, "llog.yaml", yamlConfig)); err != nil {
+		t.Fatal(err)
+	}
+	if GetLogLevel() != LevelNotice || VModule() != "db/*=trace" {
+		t.Errorf("unexpected level %v, vmodule %q", GetLogLevel(), VModule())
+	}
+	if mail_from != "app@example.com" || mail_subject != "app alert" || mail_dial.Host != "smtp.example.com" || mail_dial.Port != 587 {
+		t.Errorf("mail not initialized: %q, %q, %+v", mail_from, mail_subject, mail_dial)
+	}
+
+	Info("hidden")
+	Warn("warning")
+	output := buf.String()
+	if strings.Contains(output, "\x1b[") || !regexp.MustCompile(`^\d\d:\d\d:\d\d WARN config_test\.go:\d+ warning\n$`).MatchString(output) {
+		t.Errorf("unexpected output %q", output)
+	}
+	logFile := filepath.Join(dir, "app.log")
+	if data, _ := os.ReadFile(logFile); !regexp.MustCompile(`"time":\d{13}`).Match(data) || !strings.Contains(string(data), `"message":"warning"`) || strings.Contains(string(data), "hidden") {
+		t.Errorf("unexpected log file %q", data)
+	}
+
+	// Reloading replaces the outputs of the previous configuration
+	other := &recordSink{}
+	AddSink(other)
+	defer RemoveSink(other)
+	first := configSinks[0].(*FileWriter)
+	if err := LoadConfig(writeConfig(t, dir, "llog.json", `{"level": "info", "outputs": [{"type": "file", "path": "`+filepath.Join(dir, "new.log")+`"}]}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := first.Write(textRecord("closed")); err == nil {
+		t.Error("previous output not closed")
+	}
+	Info("reloaded")
+	if data, _ := os.ReadFile(filepath.Join(dir, "new.log")); !regexp.MustCompile(` INFO config_test\.go:\d+ reloaded\n$`).Match(data) {
+		t.Errorf("unexpected new log file %q", data)
+	}
+	if len(other.snapshot()) != 1 {
+		t.Errorf("sink added by hand was replaced: %v", other.snapshot())
+	}
+	// Colors stay disabled while the config does not set them
+	if strings.Contains(buf.String(), "\x1b[") {
+		t.Error("colors enabled by config without colors key")
+	}
+}
+
+func TestWatchConfig(t *testing.T) {
+	defer resetConfig()
+	stdout = &syncBuffer{}
+	defer func() { stdout = os.Stdout }()
+	dir := t.TempDir()
+	path := writeConfig(t, dir, "llog.yaml", "level: info\n")
+
+	if _, err := WatchConfig(filepath.Join(dir, "broken.yaml"), nil); err == nil {
+		t.Error("expected error for missing file")
+	}
+	errs := make(chan error, 10)
+	stop, err := WatchConfig(path, func(err error) { errs <- err })
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop()
+	if GetLogLevel() != LevelInfo {
+		t.Errorf("initial config not applied: %v", GetLogLevel())
+	}
+
+	waitLevel := func(level Level) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for GetLogLevel() != level {
+			if time.Now().After(deadline) {
+				t.Fatalf("level %v not applied, still %v", level, GetLogLevel())
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	writeConfig(t, dir, "llog.yaml", "level: warn\n")
+	waitLevel(LevelWarn)
+
+	// Replaced by rename like most editors do
+	writeConfig(t, dir, "llog.yaml.tmp", "level: error\n")
+	if err := os.Rename(path+".tmp", path); err != nil {
+		t.Fatal(err)
+	}
+	waitLevel(LevelError)
+
+	writeConfig(t, dir, "llog.yaml", "level: loud\n")
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "Level not found: loud") {
+			t.Errorf("unexpected error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload error not reported")
+	}
+	if GetLogLevel() != LevelError {
+		t.Errorf("failed reload applied: %v", GetLogLevel())
+	}
+
+	stop()
+	stop()
+	writeConfig(t, dir, "llog.yaml", "level: info\n")
+	time.Sleep(300 * time.Millisecond)
+	if GetLogLevel() != LevelError {
+		t.Error("reloaded after stop")
+	}
+}
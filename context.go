@@ -0,0 +1,295 @@
+package llog
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type contextKey struct{}
+
+var contextExtractorsMu sync.RWMutex
+var contextExtractors []func(ctx context.Context) map[string]any
+
+// Logger logs with a fixed set of fields, e.g. the request id and user of a request.
+// The zero value logs without fields like the package level functions.
+type Logger struct {
+	fields map[string]any
+	ctx    context.Context // context the logger was taken from, nil for the zero value
+	skip   int             // additional frames between the caller and the logger methods
+	stack  bool            // capture a stack trace for every record
+}
+
+// Return a copy of ctx carrying the given key/value pairs in addition to the fields already stored in it.
+// Keys are strings, a value without a key is stored under "!BADKEY".
+func WithContext(ctx context.Context, fields ...any) context.Context {
+	// Only the stored fields are copied, extracted ones like span ids may change in derived contexts
+	stored, ok := ctx.Value(contextKey{}).(*Logger)
+	if !ok {
+		stored = &Logger{}
+	}
+	return context.WithValue(ctx, contextKey{}, stored.With(fields...))
+}
+
+// Return the logger stored in ctx, including the fields of all registered context extractors.
+// Without one a logger without fields is returned, never nil.
+func FromContext(ctx context.Context) *Logger {
+	logger, _ := ctx.Value(contextKey{}).(*Logger)
+
+	contextExtractorsMu.RLock()
+	extractors := contextExtractors
+	contextExtractorsMu.RUnlock()
+
+	var extracted map[string]any
+	for _, extract := range extractors {
+		for key, value := range extract(ctx) {
+			if extracted == nil {
+				extracted = map[string]any{}
+			}
+			extracted[key] = value
+		}
+	}
+
+	switch {
+	case extracted == nil && logger != nil:
+		return &Logger{fields: logger.fields, ctx: ctx}
+	case extracted == nil:
+		return &Logger{ctx: ctx}
+	case logger != nil:
+		// fields stored explicitly take precedence
+		for key, value := range logger.fields {
+			extracted[key] = value
+		}
+	}
+	return &Logger{fields: extracted, ctx: ctx}
+}
+
+// Register a function adding fields from values stored in a context by other packages, e.g. tracing ids.
+// It is called by FromContext and all Ctx log functions.
+func AddContextExtractor(extract func(ctx context.Context) map[string]any) {
+	contextExtractorsMu.Lock()
+	defer contextExtractorsMu.Unlock()
+	contextExtractors = append(contextExtractors[:len(contextExtractors):len(contextExtractors)], extract)
+}
+
+// Return a new logger with the given key/value pairs added to the fields of l
+func (l *Logger) With(fields ...any) *Logger {
+	merged := make(map[string]any, len(l.fields)+len(fields)/2)
+	for key, value := range l.fields {
+		merged[key] = value
+	}
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 == len(fields) {
+			merged["!BADKEY"] = fields[i]
+			break
+		}
+		key, ok := fields[i].(string)
+		if !ok {
+			key = fmt.Sprint(fields[i])
+		}
+		merged[key] = fields[i+1]
+	}
+	return &Logger{fields: merged, ctx: l.ctx, skip: l.skip, stack: l.stack}
+}
+
+// Return a copy of l reporting the caller skip frames further up, for wrappers around the logger.
+// Functions marked with Helper are skipped without it.
+func (l *Logger) CallerSkip(skip int) *Logger {
+	return &Logger{fields: l.fields, ctx: l.ctx, skip: l.skip + skip, stack: l.stack}
+}
+
+// Return a copy of l capturing a stack trace for every record, whatever the level
+func (l *Logger) WithStack() *Logger {
+	return &Logger{fields: l.fields, ctx: l.ctx, skip: l.skip, stack: true}
+}
+
+// Return a copy of the fields of l
+func (l *Logger) Fields() map[string]any {
+	fields := make(map[string]any, len(l.fields))
+	for key, value := range l.fields {
+		fields[key] = value
+	}
+	return fields
+}
+
+func (l *Logger) Trace(msg any, a ...any) {
+	if showLevelSkip(LevelTrace, 1+l.skip) {
+		printStdout(formatLogLevelStack(LevelTrace, l.fields, 1+l.skip, l.stack, msg, a...))
+		dispatchRecord(LevelTrace, l.fields, 1+l.skip, l.stack, msg, a...)
+		addSpanEvent(l.ctx, LevelTrace, l.fields, msg, a...)
+	}
+}
+
+func (l *Logger) Debug(msg any, a ...any) {
+	if showLevelSkip(LevelDebug, 1+l.skip) {
+		printStdout(formatLogLevelStack(LevelDebug, l.fields, 1+l.skip, l.stack, msg, a...))
+		dispatchRecord(LevelDebug, l.fields, 1+l.skip, l.stack, msg, a...)
+		addSpanEvent(l.ctx, LevelDebug, l.fields, msg, a...)
+	}
+}
+
+func (l *Logger) Info(msg any, a ...any) {
+	if showLevelSkip(LevelInfo, 1+l.skip) {
+		printStdout(formatLogLevelStack(LevelInfo, l.fields, 1+l.skip, l.stack, msg, a...))
+		dispatchRecord(LevelInfo, l.fields, 1+l.skip, l.stack, msg, a...)
+		addSpanEvent(l.ctx, LevelInfo, l.fields, msg, a...)
+	}
+}
+
+func (l *Logger) Notice(msg any, a ...any) {
+	if showLevelSkip(LevelNotice, 1+l.skip) {
+		printStdout(formatLogLevelStack(LevelNotice, l.fields, 1+l.skip, l.stack, msg, a...))
+		dispatchRecord(LevelNotice, l.fields, 1+l.skip, l.stack, msg, a...)
+		addSpanEvent(l.ctx, LevelNotice, l.fields, msg, a...)
+	}
+}
+
+func (l *Logger) Warn(msg any, a ...any) {
+	if showLevelSkip(LevelWarn, 1+l.skip) {
+		printStdout(formatLogLevelStack(LevelWarn, l.fields, 1+l.skip, l.stack, msg, a...))
+		dispatchRecord(LevelWarn, l.fields, 1+l.skip, l.stack, msg, a...)
+		addSpanEvent(l.ctx, LevelWarn, l.fields, msg, a...)
+	}
+}
+
+func (l *Logger) Error(msg any, a ...any) {
+	if showLevelSkip(LevelError, 1+l.skip) {
+		printStdout(formatLogLevelStack(LevelError, l.fields, 1+l.skip, l.stack, msg, a...))
+		dispatchRecord(LevelError, l.fields, 1+l.skip, l.stack, msg, a...)
+		addSpanEvent(l.ctx, LevelError, l.fields, msg, a...)
+	}
+}
+
+// Log err at Error with the message in front and the fields of l, like ErrorErr
+func (l *Logger) ErrorErr(err error, msg any, a ...any) {
+	l.logErr(LevelError, 1+l.skip, err, formatMessage(msg, a...))
+}
+
+// Log err with the fields of l if it is not nil, like ErrNil
+func (l *Logger) ErrNil(err error, a ...any) (errNotNil bool) {
+	if err != nil {
+		l.logErr(errorLevel(err, LevelError), 1+l.skip, err, optionalMessage(a))
+		return true
+	}
+	return false
+}
+
+func (l *Logger) Critical(msg any, a ...any) {
+	if showLevelSkip(LevelCritical, 1+l.skip) {
+		printStdout(formatLogLevelStack(LevelCritical, l.fields, 1+l.skip, l.stack, msg, a...))
+		dispatchRecord(LevelCritical, l.fields, 1+l.skip, l.stack, msg, a...)
+		addSpanEvent(l.ctx, LevelCritical, l.fields, msg, a...)
+	}
+}
+
+func (l *Logger) Fatal(msg any, a ...any) {
+	if showLevelSkip(LevelFatal, 1+l.skip) {
+		format := fmt.Sprint(msg)
+		printStdout(formatLogLevelStack(LevelFatal, l.fields, 1+l.skip, l.stack, format, a...))
+		dispatchRecord(LevelFatal, l.fields, 1+l.skip, l.stack, format, a...)
+		addSpanEvent(l.ctx, LevelFatal, l.fields, format, a...)
+
+		//Exit
+		fatalExit(formatMessage(format, a...))
+	}
+}
+
+// Log at a level chosen at runtime, including custom registered levels. LevelFatal does not exit.
+func (l *Logger) Log(level Level, msg any, a ...any) {
+	if showLevelSkip(level, 1+l.skip) {
+		printStdout(formatLogLevelStack(level, l.fields, 1+l.skip, l.stack, msg, a...))
+		dispatchRecord(level, l.fields, 1+l.skip, l.stack, msg, a...)
+		addSpanEvent(l.ctx, level, l.fields, msg, a...)
+	}
+}
+
+func TraceCtx(ctx context.Context, msg any, a ...any) {
+	if showLevel(LevelTrace) {
+		fields := FromContext(ctx).fields
+		printStdout(formatLogLevel(LevelTrace, fields, msg, a...))
+		dispatch(LevelTrace, fields, msg, a...)
+		addSpanEvent(ctx, LevelTrace, fields, msg, a...)
+	}
+}
+
+func DebugCtx(ctx context.Context, msg any, a ...any) {
+	if showLevel(LevelDebug) {
+		fields := FromContext(ctx).fields
+		printStdout(formatLogLevel(LevelDebug, fields, msg, a...))
+		dispatch(LevelDebug, fields, msg, a...)
+		addSpanEvent(ctx, LevelDebug, fields, msg, a...)
+	}
+}
+
+func InfoCtx(ctx context.Context, msg any, a ...any) {
+	if showLevel(LevelInfo) {
+		fields := FromContext(ctx).fields
+		printStdout(formatLogLevel(LevelInfo, fields, msg, a...))
+		dispatch(LevelInfo, fields, msg, a...)
+		addSpanEvent(ctx, LevelInfo, fields, msg, a...)
+	}
+}
+
+func NoticeCtx(ctx context.Context, msg any, a ...any) {
+	if showLevel(LevelNotice) {
+		fields := FromContext(ctx).fields
+		printStdout(formatLogLevel(LevelNotice, fields, msg, a...))
+		dispatch(LevelNotice, fields, msg, a...)
+		addSpanEvent(ctx, LevelNotice, fields, msg, a...)
+	}
+}
+
+func WarnCtx(ctx context.Context, msg any, a ...any) {
+	if showLevel(LevelWarn) {
+		fields := FromContext(ctx).fields
+		printStdout(formatLogLevel(LevelWarn, fields, msg, a...))
+		dispatch(LevelWarn, fields, msg, a...)
+		addSpanEvent(ctx, LevelWarn, fields, msg, a...)
+	}
+}
+
+func ErrorCtx(ctx context.Context, msg any, a ...any) {
+	if showLevel(LevelError) {
+		fields := FromContext(ctx).fields
+		printStdout(formatLogLevel(LevelError, fields, msg, a...))
+		dispatch(LevelError, fields, msg, a...)
+		addSpanEvent(ctx, LevelError, fields, msg, a...)
+	}
+}
+
+// Log err at Error with the fields of ctx, like ErrorErr
+func ErrorErrCtx(ctx context.Context, err error, msg any, a ...any) {
+	FromContext(ctx).logErr(LevelError, 1, err, formatMessage(msg, a...))
+}
+
+func CriticalCtx(ctx context.Context, msg any, a ...any) {
+	if showLevel(LevelCritical) {
+		fields := FromContext(ctx).fields
+		printStdout(formatLogLevel(LevelCritical, fields, msg, a...))
+		dispatch(LevelCritical, fields, msg, a...)
+		addSpanEvent(ctx, LevelCritical, fields, msg, a...)
+	}
+}
+
+// Log at a level chosen at runtime with the fields of ctx. LevelFatal does not exit.
+func LogCtx(ctx context.Context, level Level, msg any, a ...any) {
+	if showLevel(level) {
+		fields := FromContext(ctx).fields
+		printStdout(formatLogLevel(level, fields, msg, a...))
+		dispatch(level, fields, msg, a...)
+		addSpanEvent(ctx, level, fields, msg, a...)
+	}
+}
+
+func FatalCtx(ctx context.Context, msg any, a ...any) {
+	if showLevel(LevelFatal) {
+		fields := FromContext(ctx).fields
+		format := fmt.Sprint(msg)
+		printStdout(formatLogLevel(LevelFatal, fields, format, a...))
+		dispatch(LevelFatal, fields, format, a...)
+		addSpanEvent(ctx, LevelFatal, fields, format, a...)
+
+		//Exit
+		fatalExit(formatMessage(format, a...))
+	}
+}
@@ -0,0 +1,148 @@
+package llog
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestContext(t *testing.T) {
+	SetLogLevel(LevelDebug)
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	ctx := WithContext(context.Background(), "request_id", "abc123", "user", "alice")
+	ctx = WithContext(ctx, "user", "bob", 42, true, "dangling")
+
+	DebugCtx(ctx, "debug")
+	InfoCtx(ctx, "Hello %s", "World")
+	WarnCtx(ctx, "warn")
+	ErrorCtx(ctx, "error")
+	FromContext(ctx).With("step", 2).Info("step")
+	InfoCtx(context.Background(), "plain")
+
+	if len(sink.records) != 6 {
+		t.Fatalf("expected 6 records, got %d", len(sink.records))
+	}
+	expected := map[string]any{"request_id": "abc123", "user": "bob", "42": true, "!BADKEY": "dangling"}
+	for _, record := range sink.records[:4] {
+		if len(record.Fields) != len(expected) {
+			t.Errorf("unexpected fields %v", record.Fields)
+		}
+		for key, value := range expected {
+			if record.Fields[key] != value {
+				t.Errorf("%s = %v, expected %v", key, record.Fields[key], value)
+			}
+		}
+		if record.File != "context_test.go" {
+			t.Errorf("unexpected caller %s", record.File)
+		}
+	}
+	if sink.records[1].Message != "Hello World" {
+		t.Errorf("unexpected message %q", sink.records[1].Message)
+	}
+	if sink.records[4].Fields["step"] != 2 || sink.records[4].Fields["request_id"] != "abc123" {
+		t.Errorf("unexpected fields %v", sink.records[4].Fields)
+	}
+	if sink.records[5].Fields != nil {
+		t.Errorf("unexpected fields %v", sink.records[5].Fields)
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.Contains(lines[1], "Hello World"+reset+string(DarkGray)+" !BADKEY=dangling 42=true request_id=abc123 user=bob"+reset) {
+		t.Errorf("unexpected console output %q", lines[1])
+	}
+	if strings.Contains(lines[5], "=") {
+		t.Errorf("unexpected fields in console output %q", lines[5])
+	}
+
+	// The stored logger is not modified by derived ones
+	if fields := FromContext(ctx).Fields(); fields["step"] != nil {
+		t.Errorf("derived logger changed the context fields %v", fields)
+	}
+}
+
+func TestContextExtractor(t *testing.T) {
+	type traceKey struct{}
+	defer func(saved []func(context.Context) map[string]any) { contextExtractors = saved }(contextExtractors)
+	AddContextExtractor(func(ctx context.Context) map[string]any {
+		if id, ok := ctx.Value(traceKey{}).(string); ok {
+			return map[string]any{"trace_id": id, "user": "extracted"}
+		}
+		return nil
+	})
+
+	if fields := FromContext(context.Background()).Fields(); len(fields) != 0 {
+		t.Errorf("unexpected fields %v", fields)
+	}
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "4bf92f35")
+	if fields := FromContext(ctx).Fields(); fields["trace_id"] != "4bf92f35" || fields["user"] != "extracted" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+
+	// Explicit fields take precedence over extracted ones
+	ctx = WithContext(ctx, "user", "alice")
+	if fields := FromContext(ctx).Fields(); fields["trace_id"] != "4bf92f35" || fields["user"] != "alice" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+func TestLoggerLevels(t *testing.T) {
+	SetLogLevel(LevelFatal)
+	defer SetLogLevel(LevelDebug)
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	var logger Logger
+	logger.Debug("filtered")
+	logger.Info("filtered")
+	logger.Warn("filtered")
+	logger.Error("filtered")
+	if buf.Len() != 0 {
+		t.Errorf("filtered levels printed %q", buf.String())
+	}
+
+	SetLogLevel(LevelDebug)
+	logger.Error("no fields")
+	if strings.Contains(buf.String(), string(DarkGray)+" ") {
+		t.Errorf("unexpected fields in %q", buf.String())
+	}
+}
+
+func TestFatalCtx(t *testing.T) {
+	if os.Getenv("FORK") == "1" {
+		FatalCtx(WithContext(context.Background(), "request_id", "abc123"), "Testing FatalCtx")
+		return
+	}
+
+	out, _, err := RunForkTest(t, "TestFatalCtx")
+	if err == nil || err.Error() != "exit status 2" {
+		t.Errorf("expected exit status 2, got %v", err)
+	}
+	if !strings.Contains(out, "Testing FatalCtx") || !strings.Contains(out, "request_id=abc123") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
+
+func TestLoggerFatal(t *testing.T) {
+	if os.Getenv("FORK") == "1" {
+		FromContext(context.Background()).With("user", "alice").Fatal("Testing Logger.Fatal")
+		return
+	}
+
+	out, _, err := RunForkTest(t, "TestLoggerFatal")
+	if err == nil || err.Error() != "exit status 2" {
+		t.Errorf("expected exit status 2, got %v", err)
+	}
+	if !strings.Contains(out, "Testing Logger.Fatal") || !strings.Contains(out, "user=alice") {
+		t.Errorf("unexpected output %q", out)
+	}
+}
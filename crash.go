@@ -0,0 +1,186 @@
+package llog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+type CrashOptions struct {
+	// Directory the crash files are written to, created if missing. Defaults to os.TempDir().
+	Dir string
+	// Number of recent records included in the report, defaults to 200
+	History int
+}
+
+type crashReporter struct {
+	opts    CrashOptions
+	history *RingBuffer
+}
+
+var crashReports atomic.Pointer[crashReporter]
+
+// Environment variables whose values are left out of crash reports
+var sensitiveEnv = []string{"PASS", "SECRET", "TOKEN", "KEY", "CREDENTIAL", "AUTH"}
+
+// Write a crash report when Fatal exits or RecoverAndLog catches a panic. The report holds the
+// stacks of all goroutines, the recent records, the build info and a summary of the environment.
+// The returned function disables the reports again.
+func EnableCrashReports(opts CrashOptions) (disable func(), err error) {
+	if opts.Dir == "" {
+		opts.Dir = os.TempDir()
+	}
+	if opts.History <= 0 {
+		opts.History = 200
+	}
+	if err := os.MkdirAll(opts.Dir, 0o755); err != nil {
+		return nil, fmt.Errorf("crash: %w", err)
+	}
+
+	reporter := &crashReporter{opts: opts, history: NewRingBuffer(opts.History)}
+	AddSink(reporter.history)
+	if previous := crashReports.Swap(reporter); previous != nil {
+		RemoveSink(previous.history)
+	}
+	return func() {
+		if crashReports.CompareAndSwap(reporter, nil) {
+			RemoveSink(reporter.history)
+		}
+	}, nil
+}
+
+// Recover a panic, log it as Fatal with its stack trace, write the crash report and exit like Fatal.
+// Defer it at the top of main and of goroutines: defer llog.RecoverAndLog()
+func RecoverAndLog() {
+	recovered := recover()
+	if recovered == nil {
+		return
+	}
+	if fatal, ok := recovered.(FatalExit); ok {
+		// Already logged by Fatal with SetPanicOnFatal
+		panic(fatal)
+	}
+	// Report the panicking function instead of the runtime
+	skip := externalCallerSkip([]string{"runtime."})
+	printStdout(formatLogLevelStack(LevelFatal, nil, skip, true, "panic: %v", recovered))
+	dispatchRecord(LevelFatal, nil, skip, true, "panic: %v", recovered)
+
+	fatalExit(fmt.Sprintf("panic: %v", recovered))
+}
+
+// writeCrashReport writes the crash report if enabled and prints where to find it
+func writeCrashReport(reason string) {
+	reporter := crashReports.Load()
+	if reporter == nil {
+		return
+	}
+	if path, err := reporter.write(reason, time.Now()); err != nil {
+		fmt.Fprintf(os.Stderr, "llog: writing crash report failed: %v\n", err)
+	} else {
+		fmt.Fprintf(os.Stderr, "llog: crash report written to %s\n", path)
+	}
+}
+
+func (c *crashReporter) write(reason string, now time.Time) (string, error) {
+	name := fmt.Sprintf("crash-%s-%d.log", now.Format("20060102-150405.000"), os.Getpid())
+	path := filepath.Join(c.opts.Dir, name)
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "Crash report\nTime: %s\nReason: %s\n", now.Format(time.RFC3339Nano), reason)
+	writeCrashSection(&b, "Process", processSummary())
+	writeCrashSection(&b, "Build", buildSummary())
+	writeCrashSection(&b, "Environment", environmentSummary())
+
+	var history strings.Builder
+	for _, record := range c.history.Records() {
+		if line, err := TextEncoder(record); err == nil {
+			history.Write(line)
+			history.WriteString("\n")
+		}
+	}
+	writeCrashSection(&b, "Recent records", history.String())
+	writeCrashSection(&b, "Goroutines", goroutineDump())
+
+	_, err = file.WriteString(b.String())
+	return path, errors.Join(err, file.Close())
+}
+
+func writeCrashSection(b *strings.Builder, title string, content string) {
+	b.WriteString("\n== " + title + " ==\n")
+	b.WriteString(strings.TrimSuffix(content, "\n") + "\n")
+}
+
+func processSummary() string {
+	executable, _ := os.Executable()
+	cwd, _ := os.Getwd()
+	host, _ := os.Hostname()
+	return fmt.Sprintf("PID: %d\nExecutable: %s\nArguments: %q\nWorking directory: %s\nHost: %s\n"+
+		"Uptime: %s\nGoroutines: %d\nCPUs: %d\nGOMAXPROCS: %d\n",
+		os.Getpid(), executable, os.Args[1:], cwd, host,
+		time.Since(startTime).Round(time.Millisecond), runtime.NumGoroutine(), runtime.NumCPU(), runtime.GOMAXPROCS(0))
+}
+
+func buildSummary() string {
+	summary := fmt.Sprintf("Go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return summary + "Build info not available\n"
+	}
+	summary += fmt.Sprintf("Module: %s %s\n", info.Main.Path, info.Main.Version)
+	for _, setting := range info.Settings {
+		if strings.HasPrefix(setting.Key, "vcs.") || setting.Key == "-tags" || setting.Key == "CGO_ENABLED" {
+			summary += fmt.Sprintf("%s: %s\n", setting.Key, setting.Value)
+		}
+	}
+	for _, dep := range info.Deps {
+		summary += fmt.Sprintf("Dependency: %s %s\n", dep.Path, dep.Version)
+	}
+	return summary
+}
+
+// environmentSummary lists the environment sorted by name, hiding the values of likely secrets
+func environmentSummary() string {
+	env := os.Environ()
+	sort.Strings(env)
+	var b strings.Builder
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		if hasAnySubstring(strings.ToUpper(name), sensitiveEnv) {
+			entry = name + "=<redacted>"
+		}
+		b.WriteString(entry + "\n")
+	}
+	return b.String()
+}
+
+func hasAnySubstring(s string, substrings []string) bool {
+	for _, substring := range substrings {
+		if strings.Contains(s, substring) {
+			return true
+		}
+	}
+	return false
+}
+
+// goroutineDump returns the stacks of all goroutines
+func goroutineDump() string {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 64<<20 {
+			return string(buf[:n])
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
@@ -0,0 +1,136 @@
+package llog
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func crashingFunction() {
+	panic("boom")
+}
+
+// runCrashFork runs the test in a child process writing its crash reports to a temporary directory
+func runCrashFork(t *testing.T, name string) (stdout string, stderr string, report string) {
+	dir := t.TempDir()
+	cmd := exec.Command(os.Args[0], "-test.run=^"+name+"$")
+	cmd.Env = append(os.Environ(), "FORK=1", "CRASH_DIR="+dir, "LLOG_TEST_TOKEN=hunter2")
+	var stdoutB, stderrB bytes.Buffer
+	cmd.Stdout = &stdoutB
+	cmd.Stderr = &stderrB
+	err := cmd.Run()
+	if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 2 {
+		t.Fatalf("expected exit code 2, got %v\n%s", err, stderrB.String())
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "crash-*.log"))
+	if len(files) != 1 {
+		t.Fatalf("expected one crash report, got %v", files)
+	}
+	data, _ := os.ReadFile(files[0])
+	if !strings.Contains(stderrB.String(), "llog: crash report written to "+files[0]) {
+		t.Errorf("report path not printed: %q", stderrB.String())
+	}
+	return stdoutB.String(), stderrB.String(), string(data)
+}
+
+func TestRecoverAndLog(t *testing.T) {
+	if os.Getenv("FORK") == "1" {
+		if _, err := EnableCrashReports(CrashOptions{Dir: os.Getenv("CRASH_DIR")}); err != nil {
+			t.Fatal(err)
+		}
+		defer RecoverAndLog()
+		Info("before the crash")
+		crashingFunction()
+		return
+	}
+
+	stdout, _, report := runCrashFork(t, "TestRecoverAndLog")
+	lines := strings.Split(stdout, "\n")
+	var panicLine string
+	for i, line := range lines {
+		if strings.Contains(line, "panic: boom") {
+			panicLine = line + "\n" + lines[i+1]
+		}
+	}
+	if !strings.Contains(panicLine, "FATAL") || !strings.Contains(panicLine, "crash_test.go:") ||
+		!strings.Contains(panicLine, "    at llog.crashingFunction (crash_test.go:") {
+		t.Errorf("unexpected panic output %q", stdout)
+	}
+
+	for _, expected := range []string{
+		"Reason: panic: boom\n",
+		"== Process ==\nPID: ",
+		"Go: go",
+		"== Environment ==\n",
+		"LLOG_TEST_TOKEN=<redacted>\n",
+		"INFO crash_test.go:",
+		" before the crash\n",
+		"FATAL crash_test.go:",
+		"== Goroutines ==\ngoroutine ",
+		"llog.crashingFunction(",
+		"crash_test.go:13\n",
+	} {
+		if !strings.Contains(report, expected) {
+			t.Errorf("report without %q:\n%s", expected, report)
+		}
+	}
+	if strings.Contains(report, "hunter2") {
+		t.Error("secret environment value in report")
+	}
+}
+
+func TestFatalCrashReport(t *testing.T) {
+	if os.Getenv("FORK") == "1" {
+		EnableCrashReports(CrashOptions{Dir: os.Getenv("CRASH_DIR"), History: 2})
+		Info("dropped from the history")
+		Warn("kept in the history")
+		Fatal("giving up after %d attempts", 3)
+		return
+	}
+
+	_, _, report := runCrashFork(t, "TestFatalCrashReport")
+	if !strings.Contains(report, "Reason: giving up after 3 attempts\n") || !strings.Contains(report, "kept in the history") ||
+		strings.Contains(report, "dropped from the history") {
+		t.Errorf("unexpected report:\n%s", report)
+	}
+}
+
+func TestEnableCrashReports(t *testing.T) {
+	// Nothing to recover
+	func() {
+		defer RecoverAndLog()
+	}()
+
+	dir := t.TempDir()
+	blocked := filepath.Join(dir, "file")
+	os.WriteFile(blocked, nil, 0o644)
+	if _, err := EnableCrashReports(CrashOptions{Dir: filepath.Join(blocked, "crashes")}); err == nil {
+		t.Error("expected error for unusable directory")
+	}
+
+	disable, err := EnableCrashReports(CrashOptions{Dir: filepath.Join(dir, "crashes")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	reporter := crashReports.Load()
+	path, err := reporter.write("test", startTime)
+	if err != nil || filepath.Dir(path) != filepath.Join(dir, "crashes") {
+		t.Errorf("unexpected report %q, %v", path, err)
+	}
+	disable()
+	disable()
+	if crashReports.Load() != nil {
+		t.Error("crash reports still enabled")
+	}
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	for _, s := range sinks {
+		if s == reporter.history {
+			t.Error("history still registered")
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package llog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+type DatabaseDialect int
+
+const (
+	DatabaseSQLite DatabaseDialect = iota
+	DatabasePostgres
+)
+
+const (
+	databaseDefaultTable         = "llog"
+	databaseDefaultBatchSize     = 100
+	databaseDefaultFlushInterval = time.Second
+	databaseDefaultMaxBuffer     = 10000
+	databaseDefaultPruneInterval = time.Hour
+	// fixed width, so stored timestamps sort and compare as text in SQLite
+	databaseSQLiteTimeFormat = "2006-01-02 15:04:05.000000000"
+)
+
+var databaseTableName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+var databaseSchema = map[DatabaseDialect]string{
+	DatabaseSQLite: `CREATE TABLE IF NOT EXISTS %[1]s (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time TEXT NOT NULL,
+	level TEXT NOT NULL,
+	file TEXT,
+	line INTEGER,
+	message TEXT NOT NULL,
+	fields TEXT
+);
+CREATE INDEX IF NOT EXISTS %[1]s_time ON %[1]s (time);`,
+	DatabasePostgres: `CREATE TABLE IF NOT EXISTS %[1]s (
+	id BIGSERIAL PRIMARY KEY,
+	time TIMESTAMPTZ NOT NULL,
+	level TEXT NOT NULL,
+	file TEXT,
+	line INTEGER,
+	message TEXT NOT NULL,
+	fields JSONB
+);
+CREATE INDEX IF NOT EXISTS %[1]s_time ON %[1]s (time);`,
+}
+
+var databasePlaceholders = map[DatabaseDialect][]string{
+	DatabaseSQLite:   {"?", "?", "?", "?", "?", "?"},
+	DatabasePostgres: {"$1", "$2", "$3", "$4", "$5", "$6"},
+}
+
+type DatabaseOptions struct {
+	// SQL dialect used for the schema and placeholders, defaults to SQLite
+	Dialect DatabaseDialect
+	// Table name, defaults to "llog"
+	Table string
+	// Do not create the table and index on startup
+	SkipSchema bool
+	// Records inserted per transaction, defaults to 100
+	BatchSize int
+	// Maximum time a record is buffered before being inserted, defaults to 1s
+	FlushInterval time.Duration
+	// Records kept while the database is unavailable, the oldest are dropped first. Defaults to 10000.
+	MaxBuffer int
+	// Records older than this are deleted periodically, 0 keeps them forever
+	Retention time.Duration
+	// Interval of the retention pruning, defaults to 1h
+	PruneInterval time.Duration
+	// Additional fields added to every record
+	Fields map[string]any
+}
+
+// DatabaseWriter is a Sink inserting records into a database/sql table with the columns
+// id, time, level, file, line, message and fields (a JSON object, including the function and stack trace).
+type DatabaseWriter struct {
+	db     *sql.DB
+	opts   DatabaseOptions
+	insert string
+	prune  string
+	batch  *batcher
+
+	stopPrune chan struct{}
+	wg        sync.WaitGroup
+}
+
+// Write records into db, which has to be opened with a driver matching the dialect
+func NewDatabaseWriter(db *sql.DB, opts DatabaseOptions) (*DatabaseWriter, error) {
+	if opts.Table == "" {
+		opts.Table = databaseDefaultTable
+	}
+	if !databaseTableName.MatchString(opts.Table) {
+		return nil, errors.New("database: invalid table name " + opts.Table)
+	}
+	placeholders, ok := databasePlaceholders[opts.Dialect]
+	if !ok {
+		return nil, errors.New("database: unsupported dialect")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = databaseDefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = databaseDefaultFlushInterval
+	}
+	if opts.MaxBuffer <= 0 {
+		opts.MaxBuffer = databaseDefaultMaxBuffer
+	}
+	if opts.PruneInterval <= 0 {
+		opts.PruneInterval = databaseDefaultPruneInterval
+	}
+
+	if !opts.SkipSchema {
+		if _, err := db.Exec(fmt.Sprintf(databaseSchema[opts.Dialect], opts.Table)); err != nil {
+			return nil, err
+		}
+	}
+
+	w := &DatabaseWriter{
+		db:        db,
+		opts:      opts,
+		insert:    fmt.Sprintf("INSERT INTO %s (time, level, file, line, message, fields) VALUES (%s, %s, %s, %s, %s, %s)", opts.Table, placeholders[0], placeholders[1], placeholders[2], placeholders[3], placeholders[4], placeholders[5]),
+		prune:     fmt.Sprintf("DELETE FROM %s WHERE time < %s", opts.Table, placeholders[0]),
+		stopPrune: make(chan struct{}),
+	}
+	w.batch = newBatcher(w, opts.BatchSize, opts.FlushInterval, opts.MaxBuffer, w.send)
+
+	if opts.Retention > 0 {
+		w.wg.Add(1)
+		go w.runPrune()
+	}
+	return w, nil
+}
+
+func (w *DatabaseWriter) Write(r Record) error {
+	w.batch.add(r)
+	return nil
+}
+
+// Insert all buffered records now
+func (w *DatabaseWriter) Flush() error {
+	return w.batch.flush()
+}
+
+// Insert the remaining records and stop the background jobs. The database is not closed.
+func (w *DatabaseWriter) Close() error {
+	first, err := w.batch.stop()
+	if !first {
+		return nil
+	}
+	close(w.stopPrune)
+	w.wg.Wait()
+	return err
+}
+
+// Delete all records older than the retention and return how many were removed
+func (w *DatabaseWriter) Prune() (int64, error) {
+	if w.opts.Retention <= 0 {
+		return 0, nil
+	}
+	result, err := w.db.Exec(w.prune, w.timeValue(time.Now().Add(-w.opts.Retention)))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func (w *DatabaseWriter) runPrune() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.opts.PruneInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopPrune:
+			return
+		case <-ticker.C:
+		}
+		if _, err := w.Prune(); err != nil {
+			reportSinkError(w, err)
+		}
+	}
+}
+
+// send inserts the batch in a single transaction
+func (w *DatabaseWriter) send(batch []Record) ([]Record, error) {
+	tx, err := w.db.Begin()
+	if err != nil {
+		return batch, err
+	}
+	defer tx.Rollback()
+
+	statement, err := tx.Prepare(w.insert)
+	if err != nil {
+		return batch, err
+	}
+	defer statement.Close()
+
+	for _, r := range batch {
+		// Encoded like the other sinks, without the values stored in their own columns
+		fields := recordMap(r, w.opts.Fields)
+		for _, column := range []string{"level", "message", "file", "line"} {
+			delete(fields, column)
+		}
+
+		var encoded any
+		if len(fields) > 0 {
+			data, err := json.Marshal(fields)
+			if err != nil {
+				data, _ = json.Marshal(map[string]string{"error": err.Error()})
+			}
+			encoded = string(data)
+		}
+
+		var file any
+		var line any
+		if r.File != "" {
+			file, line = r.File, r.Line
+		}
+
+		if _, err := statement.Exec(w.timeValue(r.Time), levelName(r.Level), file, line, r.Message, encoded); err != nil {
+			return batch, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return batch, err
+	}
+	return nil, nil
+}
+
+func (w *DatabaseWriter) timeValue(t time.Time) any {
+	if w.opts.Dialect == DatabaseSQLite {
+		return t.UTC().Format(databaseSQLiteTimeFormat)
+	}
+	return t
+}
@@ -0,0 +1,115 @@
+package llog
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func TestDatabase(t *testing.T) {
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "llog.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if _, err := NewDatabaseWriter(db, DatabaseOptions{Table: "logs; DROP TABLE users"}); err == nil {
+		t.Error("expected error for invalid table name")
+	}
+	if _, err := NewDatabaseWriter(db, DatabaseOptions{Dialect: 5}); err == nil {
+		t.Error("expected error for unsupported dialect")
+	}
+
+	writer, err := NewDatabaseWriter(db, DatabaseOptions{
+		Table:         "logs",
+		FlushInterval: time.Hour,
+		Retention:     24 * time.Hour,
+		PruneInterval: time.Hour,
+		Fields:        map[string]any{"service": "llog"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	writer.Write(Record{Time: now.Add(-48 * time.Hour), Level: LevelInfo, Message: "expired"})
+	writer.Write(Record{Time: now, Level: LevelError, Message: "failed", File: "main.go", Line: 12, Function: "main.run",
+		Stack: StackTrace{{Function: "main.run", File: "main.go", Line: 12}}, Fields: map[string]any{"user": "bob", "cause": errors.New("timeout")}})
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	var count int
+	db.QueryRow("SELECT COUNT(*) FROM logs").Scan(&count)
+	if count != 2 {
+		t.Fatalf("expected 2 rows, got %d", count)
+	}
+
+	var expiredFields string
+	db.QueryRow("SELECT fields FROM logs WHERE message = 'expired'").Scan(&expiredFields)
+	if expiredFields != `{"service":"llog"}` {
+		t.Errorf("expected only the static fields, got %s", expiredFields)
+	}
+
+	removed, err := writer.Prune()
+	if err != nil || removed != 1 {
+		t.Errorf("expected 1 pruned row, got %d %v", removed, err)
+	}
+
+	var timestamp, level, file, message, fields string
+	var line int
+	err = db.QueryRow("SELECT time, level, file, line, message, fields FROM logs WHERE level = 'Error'").Scan(&timestamp, &level, &file, &line, &message, &fields)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timestamp != now.UTC().Format(databaseSQLiteTimeFormat) || file != "main.go" || line != 12 || message != "failed" {
+		t.Errorf("unexpected row %s %s %s:%d %s", timestamp, level, file, line, message)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal([]byte(fields), &decoded); err != nil || decoded["user"] != "bob" || decoded["service"] != "llog" ||
+		decoded["cause"] != "timeout" || decoded["function"] != "main.run" || decoded["stack"] == nil {
+		t.Errorf("unexpected fields %s", fields)
+	}
+	for _, column := range []string{"level", "message", "file", "line"} {
+		if _, ok := decoded[column]; ok {
+			t.Errorf("column %s repeated in the fields %s", column, fields)
+		}
+	}
+
+	// The schema can be queried with JSON functions
+	var user string
+	db.QueryRow("SELECT json_extract(fields, '$.user') FROM logs").Scan(&user)
+	if user != "bob" {
+		t.Errorf("expected json_extract to find the user, got %q", user)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Error(err)
+	}
+	writer.Close()
+
+	// Failing inserts keep the records buffered
+	noSchema, err := NewDatabaseWriter(db, DatabaseOptions{Table: "missing", SkipSchema: true, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	noSchema.Write(Record{Time: now, Message: "kept"})
+	if err := noSchema.Flush(); err == nil {
+		t.Error("expected insert into missing table to fail")
+	}
+	if len(noSchema.batch.pending) != 1 {
+		t.Error("failed record was not kept")
+	}
+	if removed, err := noSchema.Prune(); removed != 0 || err != nil {
+		t.Error("prune without retention should do nothing")
+	}
+	db.Close()
+	if err := noSchema.Close(); err == nil {
+		t.Error("expected close to report the failed flush")
+	}
+}
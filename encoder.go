@@ -0,0 +1,87 @@
+package llog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Encoder serializes a record into a single line without the trailing newline
+type Encoder func(r Record) ([]byte, error)
+
+// Encode records as JSON objects with time, level, message, file, line and all fields
+func JSONEncoder(r Record) ([]byte, error) {
+	return encodeJSON(r, TimestampOptions{})
+}
+
+// Return a JSONEncoder rendering the time with opts. Unix timestamps are encoded as numbers.
+func NewJSONEncoder(opts TimestampOptions) Encoder {
+	return func(r Record) ([]byte, error) {
+		return encodeJSON(r, opts)
+	}
+}
+
+func encodeJSON(r Record, opts TimestampOptions) ([]byte, error) {
+	fields := recordMap(r, nil)
+	if stamp := opts.format(r.Time, time.RFC3339Nano); stamp == "" {
+		delete(fields, "time")
+	} else if opts.numeric() {
+		fields["time"] = json.Number(stamp)
+	} else {
+		fields["time"] = stamp
+	}
+	return json.Marshal(fields)
+}
+
+// Encode records like the console output without colors, followed by the fields as key=value
+func TextEncoder(r Record) ([]byte, error) {
+	return encodeText(r, TimestampOptions{})
+}
+
+// Return a TextEncoder rendering the time with opts
+func NewTextEncoder(opts TimestampOptions) Encoder {
+	return func(r Record) ([]byte, error) {
+		return encodeText(r, opts)
+	}
+}
+
+func encodeText(r Record, opts TimestampOptions) ([]byte, error) {
+	var parts []string
+	if stamp := opts.format(r.Time, defaultTimeFormat); stamp != "" {
+		parts = append(parts, stamp)
+	}
+	// Plain level tags, matching the console output
+	if tag := levelDefinition(r.Level).Tag; tag != "" {
+		parts = append(parts, tag)
+	}
+	if r.File != "" {
+		parts = append(parts, r.File+":"+strconv.Itoa(r.Line))
+	}
+	if r.Function != "" {
+		parts = append(parts, r.Function)
+	}
+	var b strings.Builder
+	b.WriteString(strings.Join(append(parts, strings.ReplaceAll(r.Message, "\n", `\n`)), " "))
+
+	keys := make([]string, 0, len(r.Fields))
+	for key := range r.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString(" " + key + "=" + textValue(r.Fields[key]))
+	}
+	return []byte(b.String()), nil
+}
+
+// textValue quotes values that would break the key=value format
+func textValue(value any) string {
+	text := fmt.Sprint(value)
+	if text == "" || strings.ContainsAny(text, " =\"\n\t") {
+		return strconv.Quote(text)
+	}
+	return text
+}
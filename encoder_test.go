@@ -0,0 +1,48 @@
+package llog
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestEncoders(t *testing.T) {
+	record := Record{
+		Time:    time.Date(2024, 5, 1, 12, 30, 45, 123000000, time.UTC),
+		Level:   LevelWarn,
+		Message: "disk almost full\nsecond line",
+		File:    "main.go",
+		Line:    42,
+		Fields:  map[string]any{"disk": "/dev/sda", "free": 5, "note": "two words", "empty": ""},
+	}
+
+	line, err := TextEncoder(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `2024/05/01 12:30:45 WARN main.go:42 disk almost full\nsecond line disk=/dev/sda empty="" free=5 note="two words"`
+	if string(line) != expected {
+		t.Errorf("unexpected text line\n%s\n%s", line, expected)
+	}
+
+	line, _ = TextEncoder(Record{Time: record.Time, Level: LevelPrint, Message: "plain"})
+	if string(line) != "2024/05/01 12:30:45 plain" {
+		t.Errorf("unexpected text line for print %q", line)
+	}
+
+	line, err = JSONEncoder(record)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]any
+	if err := json.Unmarshal(line, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded["time"] != "2024-05-01T12:30:45.123Z" || decoded["level"] != "Warn" || decoded["file"] != "main.go" || decoded["line"] != float64(42) || decoded["disk"] != "/dev/sda" {
+		t.Errorf("unexpected json %s", line)
+	}
+
+	if _, err := JSONEncoder(Record{Fields: map[string]any{"bad": func() {}}}); err == nil {
+		t.Error("expected error for unsupported field value")
+	}
+}
@@ -0,0 +1,160 @@
+package llog
+
+import (
+	"encoding/json"
+	"fmt"
+	"runtime"
+)
+
+// Err is the error returned by Errorf, Wrap, WithFields and WithLevel. It records where it was created,
+// fields and the level it should be logged at. errors.Is and errors.As see the errors it wraps.
+type Err struct {
+	msg     string
+	wrapped []error
+	fields  map[string]any
+	level   Level
+	leveled bool
+	pcs     []uintptr
+	// created by WithFields or WithLevel around another error, with the same message
+	annotation bool
+}
+
+// LeveledError is implemented by errors suggesting the level they are logged at by ErrNil
+type LeveledError interface {
+	error
+	Level() Level
+}
+
+// Return an error formatted like fmt.Errorf, including wrapping with %w, that records its creation site
+func Errorf(format string, a ...any) error {
+	formatted := fmt.Errorf(format, a...)
+	e := &Err{msg: formatted.Error(), pcs: callers(3)}
+	switch wrapper := formatted.(type) {
+	case interface{ Unwrap() error }:
+		e.wrapped = []error{wrapper.Unwrap()}
+	case interface{ Unwrap() []error }:
+		e.wrapped = wrapper.Unwrap()
+	}
+	return e
+}
+
+// Return err with the message in front, e.g. Wrap(err, "loading %s", path), recording the creation site.
+// Returns nil if err is nil.
+func Wrap(err error, msg any, a ...any) error {
+	if err == nil {
+		return nil
+	}
+	return &Err{msg: errorMessage(formatMessage(msg, a...), err), wrapped: []error{err}, pcs: callers(3)}
+}
+
+// Return err with the given key/value pairs added to its fields, e.g. WithFields(err, "order", id).
+// Returns nil if err is nil.
+func WithFields(err error, fields ...any) error {
+	if err == nil {
+		return nil
+	}
+	e := annotate(err)
+	e.fields = (&Logger{fields: e.fields}).With(fields...).fields
+	return e
+}
+
+// Return err suggesting to log it at level, e.g. WithLevel(err, LevelWarn) for expected failures.
+// Returns nil if err is nil.
+func WithLevel(err error, level Level) error {
+	if err == nil {
+		return nil
+	}
+	e := annotate(err)
+	e.level, e.leveled = level, true
+	return e
+}
+
+// annotate returns a copy of err if it is an *Err, otherwise an *Err wrapping it created at the caller of its caller
+func annotate(err error) *Err {
+	if e, ok := err.(*Err); ok {
+		annotated := *e
+		return &annotated
+	}
+	return &Err{msg: err.Error(), wrapped: []error{err}, pcs: callers(4), annotation: true}
+}
+
+// callers returns the program counters skip frames above runtime.Callers
+func callers(skip int) []uintptr {
+	pcs := make([]uintptr, maxStackFrames)
+	return pcs[:runtime.Callers(skip, pcs)]
+}
+
+func (e *Err) Error() string {
+	return e.msg
+}
+
+func (e *Err) Unwrap() []error {
+	return e.wrapped
+}
+
+// Return a copy of the fields of e
+func (e *Err) Fields() map[string]any {
+	return (&Logger{fields: e.fields}).Fields()
+}
+
+// Return the suggested level, LevelError if none was set
+func (e *Err) Level() Level {
+	if !e.leveled {
+		return LevelError
+	}
+	return e.level
+}
+
+// Return the stack trace of the creation of e
+func (e *Err) StackTrace() StackTrace {
+	return stackFromPCs(e.pcs)
+}
+
+// Return the location e was created at
+func (e *Err) Site() StackFrame {
+	if stack := e.StackTrace(); len(stack) > 0 {
+		return stack[0]
+	}
+	return StackFrame{}
+}
+
+// Format prints the message with %v and %s, %+v adds the fields and the stack trace
+func (e *Err) Format(s fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && s.Flag('+'):
+		fmt.Fprint(s, e.msg+ansiEscape.ReplaceAllString(formatFields(e.fields), "")+"\n"+e.StackTrace().String())
+	case verb == 'v' || verb == 's':
+		fmt.Fprint(s, e.msg)
+	case verb == 'q':
+		fmt.Fprintf(s, "%q", e.msg)
+	}
+}
+
+// MarshalJSON encodes the message with the site, level and fields, as used by the JSON encoders for field values
+func (e *Err) MarshalJSON() ([]byte, error) {
+	value := map[string]any{"message": e.msg}
+	if site := e.Site(); site.Function != "" {
+		value["site"] = site
+	}
+	if e.leveled {
+		value["level"] = levelName(e.level)
+	}
+	if len(e.fields) > 0 {
+		value["fields"] = e.fields
+	}
+	return json.Marshal(value)
+}
+
+// errorLevel returns the level suggested by the outermost error in the chain, fallback without one
+func errorLevel(err error, fallback Level) Level {
+	level, found := fallback, false
+	walkErrors(err, func(wrapped error, _ int) {
+		if e, ok := wrapped.(*Err); ok && !e.leveled {
+			return
+		}
+		if leveled, ok := wrapped.(LeveledError); ok && !found {
+			level, found = leveled.Level(), true
+		}
+	})
+	return level
+}
@@ -0,0 +1,193 @@
+package llog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestErrorf(t *testing.T) {
+	pathErr := &fs.PathError{Op: "open", Path: "orders.db", Err: syscall.ENOENT}
+	err := Errorf("opening store %d: %w", 2, pathErr)
+	line := currentLine() - 1
+
+	if err.Error() != "opening store 2: open orders.db: no such file or directory" {
+		t.Errorf("unexpected message %q", err)
+	}
+	var target *fs.PathError
+	if !errors.Is(err, fs.ErrNotExist) || !errors.As(err, &target) || target != pathErr {
+		t.Error("wrapped error not found by errors.Is and errors.As")
+	}
+	site := err.(*Err).Site()
+	if site.Function != "llog.TestErrorf" || site.File != "err_test.go" || site.Line != line {
+		t.Errorf("unexpected site %+v", site)
+	}
+
+	joined := Errorf("both: %w, %w", fs.ErrNotExist, fs.ErrPermission)
+	if !errors.Is(joined, fs.ErrNotExist) || !errors.Is(joined, fs.ErrPermission) {
+		t.Error("errors wrapped with several %w not found")
+	}
+	if errors.Unwrap(Errorf("plain")) != nil {
+		t.Error("unexpected wrapped error")
+	}
+}
+
+func TestWrap(t *testing.T) {
+	if Wrap(nil, "nothing") != nil || WithFields(nil, "a", 1) != nil || WithLevel(nil, LevelWarn) != nil {
+		t.Error("expected nil for nil errors")
+	}
+
+	err := Wrap(fs.ErrNotExist, "loading %s", "config.yml")
+	line := currentLine() - 1
+	if err.Error() != "loading config.yml: file does not exist" || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("unexpected error %q", err)
+	}
+
+	// Annotating an *Err keeps its site and leaves the original unchanged
+	annotated := WithLevel(WithFields(err, "path", "config.yml", "attempt", 2), LevelWarn).(*Err)
+	if annotated.Site().Line != line || annotated.Level() != LevelWarn || annotated.Fields()["path"] != "config.yml" {
+		t.Errorf("unexpected annotated error %+v", annotated)
+	}
+	if original := err.(*Err); len(original.Fields()) != 0 || original.Level() != LevelError {
+		t.Error("original error modified")
+	}
+	annotated.Fields()["path"] = "changed"
+	if annotated.Fields()["path"] != "config.yml" {
+		t.Error("fields not copied")
+	}
+
+	// Other errors are wrapped at the call site
+	plain := WithFields(syscall.ECONNRESET, "peer", "10.0.0.1")
+	line = currentLine() - 1
+	if plain.Error() != syscall.ECONNRESET.Error() || !errors.Is(plain, syscall.ECONNRESET) || plain.(*Err).Site().Line != line {
+		t.Errorf("unexpected wrapped error %+v", plain)
+	}
+
+	formatted := fmt.Sprintf("%+v", annotated)
+	if !strings.HasPrefix(formatted, "loading config.yml: file does not exist attempt=2 path=config.yml\n    at llog.TestWrap (err_test.go:") {
+		t.Errorf("unexpected %%+v %q", formatted)
+	}
+	if fmt.Sprintf("%v|%s|%q", err, err, err) != `loading config.yml: file does not exist|loading config.yml: file does not exist|"loading config.yml: file does not exist"` {
+		t.Errorf("unexpected formatting %v", err)
+	}
+}
+
+func TestErrorLevel(t *testing.T) {
+	base := errors.New("timeout")
+	for _, test := range []struct {
+		err      error
+		expected Level
+	}{
+		{base, LevelError},
+		{Wrap(base, "retry"), LevelError},
+		{Wrap(WithLevel(base, LevelNotice), "retry"), LevelNotice},
+		{WithLevel(Wrap(WithLevel(base, LevelDebug), "retry"), LevelWarn), LevelWarn},
+		{fmt.Errorf("outer: %w", WithLevel(base, LevelInfo)), LevelInfo},
+	} {
+		if level := errorLevel(test.err, LevelError); level != test.expected {
+			t.Errorf("%v: expected %v, got %v", test.err, test.expected, level)
+		}
+	}
+}
+
+func TestErrNilErr(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	err := WithLevel(Errorf("cache miss for %s", "user:1"), LevelWarn)
+	created := currentLine() - 1
+	err = WithFields(Wrap(err, "loading profile"), "user", 1)
+	ErrNil(err)
+	logged := currentLine() - 1
+
+	record := sink.snapshot()[0]
+	if record.Level != LevelWarn || record.Line != logged || record.Message != "loading profile: cache miss for user:1" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if record.Fields["user"] != 1 || len(record.Stack) == 0 || record.Stack[0].Line != created {
+		t.Errorf("unexpected fields %v or stack %v", record.Fields, record.Stack)
+	}
+	if chain := record.Fields["error_chain"].([]string); len(chain) != 1 || chain[0] != "cache miss for user:1" {
+		t.Errorf("unexpected chain %q", chain)
+	}
+	if !strings.Contains(buf.String(), levelNameFormatted(LevelWarn)) || !strings.Contains(buf.String(), "user=1") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	// FatalNil always exits but keeps the context of the error
+	exit := catchFatal(func() { FatalNil(err, "giving up") })
+	record = sink.snapshot()[1]
+	if exit == nil || record.Level != LevelFatal || record.Fields["user"] != 1 || exit.Reason != "giving up: "+err.Error() {
+		t.Errorf("unexpected record %+v for exit %+v", record, exit)
+	}
+}
+
+func TestErrNilAnnotated(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	// Annotating a plain error does not repeat its message as cause
+	ErrNil(WithLevel(errors.New("disk full"), LevelWarn))
+	ErrNil(WithFields(errors.New("disk full"), "disk", "sda"))
+	if strings.Contains(buf.String(), "caused by") || strings.Count(buf.String(), "disk full") != 2 ||
+		!strings.Contains(buf.String(), levelNameFormatted(LevelWarn)) || !strings.Contains(buf.String(), "disk=sda") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	buf.Reset()
+	ErrNil(fmt.Errorf("saving: %w", WithLevel(errors.New("disk full"), LevelWarn)))
+	if strings.Count(buf.String(), "caused by: disk full") != 1 {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	// The errors below the annotated one keep their depth
+	buf.Reset()
+	ErrNil(WithFields(fmt.Errorf("writing: %w", fs.ErrPermission), "path", "/tmp"))
+	if strings.Count(buf.String(), "caused by") != 1 || !strings.Contains(buf.String(), "m    caused by: permission denied") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestEncodeErrorFields(t *testing.T) {
+	err := WithLevel(WithFields(Errorf("declined"), "order", 42), LevelWarn)
+	line := currentLine() - 1
+	record := Record{Level: LevelError, Message: "checkout failed", Fields: map[string]any{
+		"cause": err,
+		"plain": errors.New("card expired"),
+	}}
+
+	data, _ := JSONEncoder(record)
+	var decoded struct {
+		Cause struct {
+			Message string
+			Level   string
+			Site    StackFrame
+			Fields  map[string]any
+		}
+		Plain string
+	}
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	cause := decoded.Cause
+	if cause.Message != "declined" || cause.Level != levelName(LevelWarn) || cause.Fields["order"] != float64(42) ||
+		cause.Site.Function != "llog.TestEncodeErrorFields" || cause.Site.Line != line || decoded.Plain != "card expired" {
+		t.Errorf("unexpected json %s", data)
+	}
+
+	text, _ := TextEncoder(record)
+	if !strings.HasSuffix(string(text), `cause=declined plain="card expired"`) {
+		t.Errorf("unexpected text %s", text)
+	}
+}
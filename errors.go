@@ -0,0 +1,207 @@
+package llog
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Maximum number of errors of a chain that are unwrapped
+const maxErrorChain = 32
+
+// FieldsError is implemented by errors carrying fields for their records, e.g. the id of a failed order.
+// The fields of all errors in the chain are added, outer errors overriding inner ones.
+type FieldsError interface {
+	error
+	Fields() map[string]any
+}
+
+// StackError is implemented by errors carrying the stack trace of their creation.
+// Errors of github.com/pkg/errors and errors with a Callers() []uintptr method are recognized as well.
+type StackError interface {
+	error
+	StackTrace() StackTrace
+}
+
+// Error types that only add text to the chain, their type is not shown
+var plainErrorTypes = map[string]bool{
+	"*errors.errorString": true,
+	"*errors.joinError":   true,
+	"*fmt.wrapError":      true,
+	"*fmt.wrapErrors":     true,
+	"*llog.Err":           true,
+}
+
+// logErr logs err with msg in front at level and the location skip frames above its caller.
+// It returns false if the level is hidden.
+func (l *Logger) logErr(level Level, skip int, err error, msg string) bool {
+	if !showLevelSkip(level, skip+1) {
+		return false
+	}
+	message := errorMessage(msg, err)
+	fields := errorFields(err, l.fields)
+	chain := unwrapChain(err)
+	trace := errorStack(err)
+	if trace == nil && (l.stack || levelDefinition(level).Stack) {
+		trace = captureStack(skip + 1)
+	}
+
+	details := make([]string, 0, len(chain)+1)
+	for _, link := range chain {
+		details = append(details, strings.Repeat("  ", link.depth-1)+"    caused by: "+link.text)
+	}
+	if len(trace) > 0 {
+		details = append(details, trace.String())
+	}
+	printStdout(formatLogLevelDetails(level, fields, skip+1, details, "%s", message))
+
+	recordFields := fields
+	if len(chain) > 0 {
+		recordFields = make(map[string]any, len(fields)+1)
+		for key, value := range fields {
+			recordFields[key] = value
+		}
+		texts := make([]string, len(chain))
+		for i, link := range chain {
+			texts[i] = link.text
+		}
+		recordFields["error_chain"] = texts
+	}
+	dispatchTrace(level, recordFields, skip+1, trace, "%s", message)
+	addSpanEvent(l.ctx, level, recordFields, "%s", message)
+	return true
+}
+
+// optionalMessage formats the optional message and arguments of ErrNil and FatalNil
+func optionalMessage(a []any) string {
+	if len(a) == 0 {
+		return ""
+	}
+	return formatMessage(a[0], a[1:]...)
+}
+
+// errorMessage joins the message and the error like fmt.Errorf("msg: %w", err)
+func errorMessage(msg string, err error) string {
+	switch {
+	case err == nil:
+		return msg
+	case msg == "":
+		return err.Error()
+	}
+	return msg + ": " + err.Error()
+}
+
+// walkErrors visits err and the errors it wraps depth first, including the branches of errors.Join
+func walkErrors(err error, visit func(err error, depth int)) {
+	visited := 0
+	var walk func(err error, depth int)
+	walk = func(err error, depth int) {
+		if err == nil || visited == maxErrorChain {
+			return
+		}
+		visited++
+		visit(err, depth)
+		switch wrapper := err.(type) {
+		case interface{ Unwrap() error }:
+			walk(wrapper.Unwrap(), depth+1)
+		case interface{ Unwrap() []error }:
+			for _, wrapped := range wrapper.Unwrap() {
+				walk(wrapped, depth+1)
+			}
+		}
+	}
+	walk(err, 0)
+}
+
+// errorLink is an error wrapped by the logged one, depth 1 being wrapped directly
+type errorLink struct {
+	depth int
+	text  string
+}
+
+// unwrapChain lists the errors wrapped by err with their type unless it is a plain one.
+// Annotations of WithFields and WithLevel are left out, the error they wrap takes their place.
+func unwrapChain(err error) []errorLink {
+	var chain []errorLink
+	var annotations []int // depths of the annotations above the visited error
+	walkErrors(err, func(wrapped error, depth int) {
+		for len(annotations) > 0 && annotations[len(annotations)-1] >= depth {
+			annotations = annotations[:len(annotations)-1]
+		}
+		if e, ok := wrapped.(*Err); ok && e.annotation {
+			annotations = append(annotations, depth)
+			return
+		}
+		depth -= len(annotations)
+		if depth == 0 {
+			return
+		}
+		text := wrapped.Error()
+		if errorType := fmt.Sprintf("%T", wrapped); !plainErrorTypes[errorType] {
+			text += " (" + errorType + ")"
+		}
+		chain = append(chain, errorLink{depth: depth, text: text})
+	})
+	return chain
+}
+
+// errorFields merges the fields of all errors in the chain with fields, which take precedence
+func errorFields(err error, fields map[string]any) map[string]any {
+	var carriers []FieldsError
+	walkErrors(err, func(wrapped error, _ int) {
+		if carrier, ok := wrapped.(FieldsError); ok {
+			carriers = append(carriers, carrier)
+		}
+	})
+	if len(carriers) == 0 {
+		return fields
+	}
+
+	merged := map[string]any{}
+	for i := len(carriers) - 1; i >= 0; i-- {
+		for key, value := range carriers[i].Fields() {
+			merged[key] = value
+		}
+	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return merged
+}
+
+// errorStack returns the stack trace of the innermost error in the chain carrying one
+func errorStack(err error) StackTrace {
+	var trace StackTrace
+	walkErrors(err, func(wrapped error, _ int) {
+		if carried := carriedStack(wrapped); carried != nil {
+			trace = carried
+		}
+	})
+	return trace
+}
+
+func carriedStack(err error) StackTrace {
+	switch carrier := err.(type) {
+	case StackError:
+		return carrier.StackTrace()
+	case interface{ Callers() []uintptr }:
+		return stackFromPCs(carrier.Callers())
+	}
+
+	// github.com/pkg/errors: StackTrace() errors.StackTrace, a slice of uintptr frames
+	method := reflect.ValueOf(err).MethodByName("StackTrace")
+	if !method.IsValid() {
+		return nil
+	}
+	methodType := method.Type()
+	if methodType.NumIn() != 0 || methodType.NumOut() != 1 ||
+		methodType.Out(0).Kind() != reflect.Slice || methodType.Out(0).Elem().Kind() != reflect.Uintptr {
+		return nil
+	}
+	frames := method.Call(nil)[0]
+	pcs := make([]uintptr, frames.Len())
+	for i := range pcs {
+		pcs[i] = uintptr(frames.Index(i).Uint())
+	}
+	return stackFromPCs(pcs)
+}
@@ -0,0 +1,213 @@
+package llog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+type fieldsError struct {
+	fields  map[string]any
+	wrapped error
+}
+
+func (e *fieldsError) Error() string          { return e.wrapped.Error() }
+func (e *fieldsError) Unwrap() error          { return e.wrapped }
+func (e *fieldsError) Fields() map[string]any { return e.fields }
+
+// callersError carries its stack like github.com/go-errors/errors
+type callersError struct{ pcs []uintptr }
+
+func (e *callersError) Error() string      { return "with callers" }
+func (e *callersError) Callers() []uintptr { return e.pcs }
+
+// pkgError carries its stack like github.com/pkg/errors
+type pkgFrame uintptr
+type pkgStackTrace []pkgFrame
+type pkgError struct{ stack pkgStackTrace }
+
+func (e *pkgError) Error() string             { return "with pkg stack" }
+func (e *pkgError) StackTrace() pkgStackTrace { return e.stack }
+
+func newCallersError() error {
+	pcs := make([]uintptr, 32)
+	return &callersError{pcs: pcs[:runtime.Callers(1, pcs)]}
+}
+
+func newPkgError() error {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(1, pcs)
+	stack := make(pkgStackTrace, n)
+	for i := range stack {
+		stack[i] = pkgFrame(pcs[i])
+	}
+	return &pkgError{stack: stack}
+}
+
+func TestErrNilMessage(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	if !ErrNil(errors.New("disk full"), "saving %s", "report.pdf") {
+		t.Error("ErrNil returned false for an error")
+	}
+	line := currentLine() - 3
+	if ErrNil(nil, "not logged") {
+		t.Error("ErrNil returned true for nil")
+	}
+	ErrNil(errors.New("100% broken"))
+
+	records := sink.snapshot()
+	if len(records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(records))
+	}
+	if records[0].Message != "saving report.pdf: disk full" || records[0].Line != line || records[0].Level != LevelError {
+		t.Errorf("unexpected record %+v", records[0])
+	}
+	if records[1].Message != "100% broken" {
+		t.Errorf("unexpected message %q", records[1].Message)
+	}
+	if !strings.Contains(buf.String(), "errors_test.go:"+strconv.Itoa(line)+reset+" ") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	// Hidden levels are not logged but still reported
+	SetLogLevel(LevelFatal)
+	defer SetLogLevel(LevelDebug)
+	if !ErrNil(errors.New("hidden")) || len(sink.snapshot()) != 2 {
+		t.Error("hidden error logged")
+	}
+}
+
+func TestErrorErrChain(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	pathErr := &fs.PathError{Op: "open", Path: "settings.yml", Err: syscall.ENOENT}
+	err := fmt.Errorf("loading config: %w", errors.Join(pathErr, errors.New("no defaults")))
+	ErrorErr(err, "starting %s", "server")
+
+	record := sink.snapshot()[0]
+	if record.Message != "starting server: loading config: open settings.yml: no such file or directory\nno defaults" {
+		t.Errorf("unexpected message %q", record.Message)
+	}
+	expected := []string{
+		"open settings.yml: no such file or directory\nno defaults",
+		"open settings.yml: no such file or directory (*fs.PathError)",
+		"no such file or directory (syscall.Errno)",
+		"no defaults",
+	}
+	if chain, _ := record.Fields["error_chain"].([]string); strings.Join(chain, "|") != strings.Join(expected, "|") {
+		t.Errorf("unexpected chain %q", chain)
+	}
+	for _, line := range []string{
+		"\n" + string(DarkGray) + "    caused by: open settings.yml: no such file or directory\nno defaults" + reset,
+		"\n" + string(DarkGray) + "      caused by: open settings.yml: no such file or directory (*fs.PathError)" + reset,
+		"\n" + string(DarkGray) + "        caused by: no such file or directory (syscall.Errno)" + reset,
+		"\n" + string(DarkGray) + "      caused by: no defaults" + reset,
+	} {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("output without %q: %q", line, buf.String())
+		}
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Error("chain not compatible with errors.Is")
+	}
+
+	// Without wrapped errors the record has no chain
+	ErrorErr(errors.New("plain"), "")
+	if record := sink.snapshot()[1]; record.Message != "plain" || record.Fields != nil {
+		t.Errorf("unexpected record %+v", record)
+	}
+}
+
+func TestErrorFields(t *testing.T) {
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	inner := &fieldsError{fields: map[string]any{"order": 42, "attempt": 1}, wrapped: errors.New("payment declined")}
+	outer := &fieldsError{fields: map[string]any{"attempt": 3}, wrapped: fmt.Errorf("charging: %w", inner)}
+	FromContext(context.Background()).With("order", 7).ErrorErr(outer, "checkout")
+	ErrorErrCtx(WithContext(context.Background(), "user", "ada"), inner, "retry")
+	FromContext(context.Background()).ErrNil(inner)
+
+	records := sink.snapshot()
+	if fields := records[0].Fields; fields["order"] != 7 || fields["attempt"] != 3 {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if fields := records[1].Fields; fields["order"] != 42 || fields["user"] != "ada" || records[1].Message != "retry: payment declined" {
+		t.Errorf("unexpected record %+v", records[1])
+	}
+	if fields := records[2].Fields; fields["order"] != 42 || records[2].Message != "payment declined" {
+		t.Errorf("unexpected record %+v", records[2])
+	}
+}
+
+func TestErrorStack(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	for _, test := range []struct {
+		err      error
+		function string
+	}{
+		{fmt.Errorf("wrapped: %w", newCallersError()), "llog.newCallersError"},
+		{newPkgError(), "llog.newPkgError"},
+		{&fieldsError{wrapped: newPkgError()}, "llog.newPkgError"},
+	} {
+		buf.Reset()
+		ErrorErr(test.err, "failed")
+		record := sink.snapshot()[len(sink.snapshot())-1]
+		if len(record.Stack) == 0 || record.Stack[0].Function != test.function || record.Stack[1].Function != "llog.TestErrorStack" {
+			t.Errorf("%v: unexpected stack %v", test.err, record.Stack)
+		}
+		if !strings.Contains(buf.String(), "    at "+test.function+" (errors_test.go:") {
+			t.Errorf("unexpected output %q", buf.String())
+		}
+	}
+
+	// The stack of the error takes precedence over the one captured by the level
+	SetLevelStack(LevelError, true)
+	defer SetLevelStack(LevelError, false)
+	ErrorErr(newCallersError(), "failed")
+	if record := sink.snapshot()[len(sink.snapshot())-1]; record.Stack[0].Function != "llog.newCallersError" {
+		t.Errorf("unexpected stack %v", record.Stack)
+	}
+	ErrorErr(errors.New("without stack"), "failed")
+	if record := sink.snapshot()[len(sink.snapshot())-1]; record.Stack[0].Function != "llog.TestErrorStack" {
+		t.Errorf("unexpected stack %v", record.Stack)
+	}
+}
+
+func TestFatalNilMessage(t *testing.T) {
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+
+	exit := catchFatal(func() { FatalNil(fmt.Errorf("dial: %w", syscall.ECONNREFUSED), "connecting to %s", "db") })
+	if exit == nil || exit.Reason != "connecting to db: dial: connection refused" {
+		t.Errorf("unexpected exit %+v", exit)
+	}
+}
@@ -0,0 +1,162 @@
+package llog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const defaultShutdownTimeout = 5 * time.Second
+
+// FatalExit is the panic value of Fatal with SetPanicOnFatal, recover it to test fatal paths in-process
+type FatalExit struct {
+	Code   int
+	Reason string
+}
+
+func (e FatalExit) Error() string {
+	return fmt.Sprintf("fatal exit %d: %s", e.Code, e.Reason)
+}
+
+type shutdownHook struct {
+	run func(ctx context.Context) error
+}
+
+var exitMu sync.Mutex
+var exitFunc = os.Exit
+var panicOnFatal bool
+var shutdownHooks []*shutdownHook
+var shutdownTimeout = defaultShutdownTimeout
+
+// Set the function Fatal exits with after the shutdown hooks ran, nil restores os.Exit.
+// Fatal returns to its caller if the function does.
+func SetExitFunc(exit func(code int)) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	if exit == nil {
+		exit = os.Exit
+	}
+	exitFunc = exit
+}
+
+// Panic with a FatalExit instead of exiting, so tests can recover Fatal instead of forking a process.
+// Deferred functions run as with any panic.
+func SetPanicOnFatal(enabled bool) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	panicOnFatal = enabled
+}
+
+// Register a hook run by Fatal and Shutdown before the process exits, e.g. to send notifications or
+// close files. Hooks run once, the last registered first, and Fatal flushes the sinks after them.
+// The returned function removes the hook.
+func OnShutdown(hook func(ctx context.Context) error) (remove func()) {
+	registered := &shutdownHook{run: hook}
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	shutdownHooks = append(shutdownHooks, registered)
+	return func() {
+		exitMu.Lock()
+		defer exitMu.Unlock()
+		for i, h := range shutdownHooks {
+			if h == registered {
+				shutdownHooks = append(shutdownHooks[:i:i], shutdownHooks[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Set how long the shutdown hooks may take together, defaults to 5 seconds.
+// Their context is canceled after it and the exit goes ahead.
+func SetShutdownTimeout(timeout time.Duration) {
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	shutdownTimeout = timeout
+}
+
+// Run the shutdown hooks now, e.g. at the end of main. Errors of the individual hooks are joined.
+func Shutdown() error {
+	exitMu.Lock()
+	hooks := shutdownHooks
+	shutdownHooks = nil
+	timeout := shutdownTimeout
+	exitMu.Unlock()
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() {
+		var errs []error
+		for i := len(hooks) - 1; i >= 0; i-- {
+			if err := hooks[i].call(ctx); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		done <- errors.Join(errs...)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown: hooks did not finish within %s", timeout)
+	}
+}
+
+// flushSinksUntil runs FlushSinks, giving up on sinks still flushing at deadline
+func flushSinksUntil(deadline time.Time) error {
+	done := make(chan error, 1)
+	go func() { done <- FlushSinks() }()
+
+	timer := time.NewTimer(time.Until(deadline))
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		return err
+	case <-timer.C:
+		return errors.New("shutdown: sinks not flushed before the shutdown timeout")
+	}
+}
+
+// call runs the hook, turning a panic into an error so the remaining hooks still run
+func (h *shutdownHook) call(ctx context.Context) (err error) {
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			err = fmt.Errorf("shutdown: hook panicked: %v", recovered)
+		}
+	}()
+	return h.run(ctx)
+}
+
+// fatalExit writes the crash report, runs the shutdown hooks, flushes the sinks and exits like a panic
+func fatalExit(reason string) {
+	writeCrashReport(reason)
+	exitMu.Lock()
+	deadline := time.Now().Add(shutdownTimeout)
+	exitMu.Unlock()
+	if err := Shutdown(); err != nil {
+		fmt.Fprintf(os.Stderr, "llog: %v\n", err)
+	}
+	// Batching sinks still hold the Fatal record, flush them in the time the hooks left
+	if err := flushSinksUntil(deadline); err != nil {
+		fmt.Fprintf(os.Stderr, "llog: %v\n", err)
+	}
+
+	exitMu.Lock()
+	exit, panics := exitFunc, panicOnFatal
+	exitMu.Unlock()
+	if panics {
+		panic(FatalExit{Code: 2, Reason: reason})
+	}
+	exit(2) //using the same exit code as panic
+}
@@ -0,0 +1,196 @@
+package llog
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// catchFatal runs fn with SetPanicOnFatal and returns the recovered exit, nil if fn returned
+func catchFatal(fn func()) (exit *FatalExit) {
+	SetPanicOnFatal(true)
+	defer SetPanicOnFatal(false)
+	defer func() {
+		if recovered := recover(); recovered != nil {
+			fatal := recovered.(FatalExit)
+			exit = &fatal
+		}
+	}()
+	fn()
+	return nil
+}
+
+func TestPanicOnFatal(t *testing.T) {
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	deferred := false
+	for _, test := range []struct {
+		fn     func()
+		reason string
+	}{
+		{func() { Fatal("failed after %d tries", 3) }, "failed after 3 tries"},
+		{func() { FatalNil(errors.New("disk full")) }, "disk full"},
+		{func() { FromContext(context.Background()).With("id", 1).Fatal("logger") }, "logger"},
+		{func() { FatalCtx(context.Background(), "context %s", "fatal") }, "context fatal"},
+		{func() { defer func() { deferred = true }(); Fatal("deferred") }, "deferred"},
+		{func() { defer RecoverAndLog(); Fatal("passed on") }, "passed on"},
+	} {
+		exit := catchFatal(test.fn)
+		if exit == nil || exit.Code != 2 || exit.Reason != test.reason {
+			t.Errorf("expected exit with %q, got %+v", test.reason, exit)
+		}
+	}
+	if !deferred {
+		t.Error("deferred function did not run")
+	}
+	if strings.Count(buf.String(), "passed on") != 1 {
+		t.Errorf("Fatal recovered by RecoverAndLog logged again: %q", buf.String())
+	}
+	if exit := catchFatal(func() { FatalNil(nil) }); exit != nil {
+		t.Errorf("unexpected exit %+v", exit)
+	}
+}
+
+func TestSetExitFunc(t *testing.T) {
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	var codes []int
+	SetExitFunc(func(code int) { codes = append(codes, code) })
+	defer SetExitFunc(nil)
+
+	Fatal("first")
+	if !FatalNil(errors.New("second")) {
+		t.Error("FatalNil returned false for an error")
+	}
+	if len(codes) != 2 || codes[0] != 2 || codes[1] != 2 {
+		t.Errorf("unexpected exit codes %v", codes)
+	}
+}
+
+func TestShutdownHooks(t *testing.T) {
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+
+	var order []string
+	hook := func(name string, err error) func(context.Context) error {
+		return func(ctx context.Context) error {
+			if _, ok := ctx.Deadline(); !ok {
+				t.Error("hook context without deadline")
+			}
+			order = append(order, name)
+			return err
+		}
+	}
+	OnShutdown(hook("flush", nil))
+	remove := OnShutdown(hook("removed", nil))
+	OnShutdown(hook("notify", errors.New("mail server down")))
+	OnShutdown(func(context.Context) error { panic("hook bug") })
+	remove()
+
+	err := Shutdown()
+	if strings.Join(order, ",") != "notify,flush" {
+		t.Errorf("unexpected order %v", order)
+	}
+	if err == nil || !strings.Contains(err.Error(), "mail server down") || !strings.Contains(err.Error(), "hook panicked: hook bug") {
+		t.Errorf("unexpected error %v", err)
+	}
+	// Hooks run once
+	if err := Shutdown(); err != nil || len(order) != 2 {
+		t.Errorf("hooks ran again: %v %v", order, err)
+	}
+
+	// Fatal runs the hooks before exiting
+	OnShutdown(hook("fatal", nil))
+	if exit := catchFatal(func() { Fatal("exit") }); exit == nil || len(order) != 3 || order[2] != "fatal" {
+		t.Errorf("hooks not run by Fatal: %v %+v", order, exit)
+	}
+}
+
+// flushSink records whether it was flushed, Flush blocks until release is closed if it is set
+type flushSink struct {
+	recordSink
+	flushed chan struct{}
+	release chan struct{}
+	once    sync.Once
+}
+
+func (s *flushSink) Flush() error {
+	s.once.Do(func() { close(s.flushed) })
+	if s.release != nil {
+		<-s.release
+	}
+	return nil
+}
+
+func TestFatalFlushesSinks(t *testing.T) {
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	sink := &flushSink{flushed: make(chan struct{})}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	// The sinks are flushed after the hooks, which may still log
+	OnShutdown(func(context.Context) error {
+		select {
+		case <-sink.flushed:
+			t.Error("sinks flushed before the hooks ran")
+		default:
+		}
+		return nil
+	})
+	if exit := catchFatal(func() { Fatal("exit") }); exit == nil {
+		t.Fatal("Fatal returned")
+	}
+	select {
+	case <-sink.flushed:
+	default:
+		t.Error("sinks not flushed by Fatal")
+	}
+
+	// A hanging sink does not keep Fatal from exiting
+	SetShutdownTimeout(50 * time.Millisecond)
+	defer SetShutdownTimeout(0)
+	hanging := &flushSink{flushed: make(chan struct{}), release: make(chan struct{})}
+	defer close(hanging.release)
+	AddSink(hanging)
+	defer RemoveSink(hanging)
+	start := time.Now()
+	if exit := catchFatal(func() { Fatal("hanging") }); exit == nil || time.Since(start) > time.Second {
+		t.Errorf("Fatal waited %s for a hanging sink", time.Since(start))
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	SetShutdownTimeout(50 * time.Millisecond)
+	defer SetShutdownTimeout(0)
+	release := make(chan struct{})
+	defer close(release)
+	canceled := make(chan struct{})
+	OnShutdown(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(canceled)
+		<-release
+		return nil
+	})
+
+	start := time.Now()
+	err := Shutdown()
+	if err == nil || !strings.Contains(err.Error(), "did not finish within 50ms") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("shutdown waited %s", elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("hook context not canceled")
+	}
+}
@@ -0,0 +1,89 @@
+package llog
+
+import (
+	"os"
+	"sync"
+)
+
+type FileOptions struct {
+	// Encoding of the records, one per line. Defaults to TextEncoder.
+	Encoder Encoder
+	// Permissions of a newly created file, defaults to 0644
+	Mode os.FileMode
+}
+
+// FileWriter is a Sink appending encoded records as lines to a file.
+// Reopen it after the file was moved away, e.g. by logrotate, to continue in a new file.
+type FileWriter struct {
+	path string
+	opts FileOptions
+
+	mu   sync.Mutex
+	file *os.File // nil once closed
+}
+
+// Append to the file at path, creating it if necessary
+func NewFileWriter(path string, opts FileOptions) (*FileWriter, error) {
+	if opts.Encoder == nil {
+		opts.Encoder = TextEncoder
+	}
+	if opts.Mode == 0 {
+		opts.Mode = 0o644
+	}
+	w := &FileWriter{path: path, opts: opts}
+	file, err := w.open()
+	if err != nil {
+		return nil, err
+	}
+	w.file = file
+	return w, nil
+}
+
+func (w *FileWriter) open() (*os.File, error) {
+	return os.OpenFile(w.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, w.opts.Mode)
+}
+
+func (w *FileWriter) Write(r Record) error {
+	line, err := w.opts.Encoder(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return os.ErrClosed
+	}
+	_, err = w.file.Write(line)
+	return err
+}
+
+// Close the file and open the path again. On failure the old file is kept.
+func (w *FileWriter) Reopen() error {
+	file, err := w.open()
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		file.Close()
+		return os.ErrClosed
+	}
+	old := w.file
+	w.file = file
+	return old.Close()
+}
+
+func (w *FileWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
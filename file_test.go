@@ -0,0 +1,80 @@
+package llog
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileWriter(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "app.log")
+
+	if _, err := NewFileWriter(filepath.Join(dir, "missing", "app.log"), FileOptions{}); err == nil {
+		t.Error("expected error for missing directory")
+	}
+	os.WriteFile(path, []byte("existing\n"), 0o644)
+	writer, err := NewFileWriter(path, FileOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	AddSink(writer)
+	defer RemoveSink(writer)
+
+	writer.Write(textRecord("before rotation"))
+	if err := os.Rename(path, path+".1"); err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(textRecord("into rotated file"))
+	if err := ReopenSinks(); err != nil {
+		t.Fatal(err)
+	}
+	writer.Write(textRecord("after rotation"))
+
+	rotated, _ := os.ReadFile(path + ".1")
+	lines := strings.Split(strings.TrimSuffix(string(rotated), "\n"), "\n")
+	if len(lines) != 3 || lines[0] != "existing" || !strings.HasSuffix(lines[2], " INFO into rotated file") {
+		t.Errorf("unexpected rotated file %q", rotated)
+	}
+	current, _ := os.ReadFile(path)
+	if !strings.HasSuffix(string(current), " INFO after rotation\n") || strings.Count(string(current), "\n") != 1 {
+		t.Errorf("unexpected current file %q", current)
+	}
+
+	// A failed reopen keeps the old file
+	os.Remove(path)
+	os.Mkdir(path, 0o755)
+	if err := writer.Reopen(); err == nil {
+		t.Error("expected error reopening a directory")
+	}
+	if err := writer.Write(textRecord("kept")); err != nil {
+		t.Error(err)
+	}
+
+	// Encoder and mode of new files
+	jsonPath := filepath.Join(dir, "app.json")
+	jsonWriter, err := NewFileWriter(jsonPath, FileOptions{Encoder: JSONEncoder, Mode: 0o600})
+	if err != nil {
+		t.Fatal(err)
+	}
+	jsonWriter.Write(textRecord("json"))
+	jsonWriter.Close()
+	if data, _ := os.ReadFile(jsonPath); !strings.Contains(string(data), `"message":"json"`) {
+		t.Errorf("unexpected json file %q", data)
+	}
+	if info, _ := os.Stat(jsonPath); info.Mode().Perm() != 0o600 {
+		t.Errorf("unexpected mode %v", info.Mode())
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := writer.Write(textRecord("closed")); err == nil {
+		t.Error("expected error writing to closed writer")
+	}
+	if err := writer.Reopen(); err == nil {
+		t.Error("expected error reopening closed writer")
+	}
+}
@@ -0,0 +1,203 @@
+package llog
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	fluentDefaultTag           = "llog"
+	fluentDefaultBatchSize     = 100
+	fluentDefaultFlushInterval = time.Second
+	fluentDefaultAckTimeout    = 5 * time.Second
+	fluentDefaultMaxBuffer     = 10000
+	fluentMaxBackoff           = 30 * time.Second
+)
+
+type FluentOptions struct {
+	// Tag of all events, defaults to "llog"
+	Tag string
+	// Append the lowercase level name to the tag, e.g. "llog.warn"
+	LevelTag bool
+	// Records sent in one PackedForward message, defaults to 100
+	BatchSize int
+	// Maximum time a record is buffered before being sent, defaults to 1s
+	FlushInterval time.Duration
+	// Request an ack for every chunk and resend it if the ack is missing
+	RequireAck bool
+	// Time to wait for an ack, defaults to 5s
+	AckTimeout time.Duration
+	// Records kept while Fluentd is unreachable, the oldest are dropped first. Defaults to 10000.
+	MaxBuffer int
+	// Additional fields added to every record
+	Fields map[string]any
+}
+
+// FluentWriter is a Sink sending records to Fluentd or Fluent Bit using the forward protocol.
+// Records are buffered and sent in PackedForward mode from a background goroutine.
+type FluentWriter struct {
+	network string
+	addr    string
+	opts    FluentOptions
+
+	batch *batcher
+
+	// guarded by batch.sendMu
+	conn    net.Conn
+	reader  *bufio.Reader
+	backoff time.Duration
+	retryAt time.Time
+}
+
+// Connect to a Fluentd forward input. network is "tcp" or "unix".
+func NewFluentWriter(network string, addr string, opts FluentOptions) (*FluentWriter, error) {
+	if !strings.HasPrefix(network, "tcp") && network != "unix" {
+		return nil, errors.New("fluent: unsupported network " + network)
+	}
+	if opts.Tag == "" {
+		opts.Tag = fluentDefaultTag
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = fluentDefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = fluentDefaultFlushInterval
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = fluentDefaultAckTimeout
+	}
+	if opts.MaxBuffer <= 0 {
+		opts.MaxBuffer = fluentDefaultMaxBuffer
+	}
+
+	w := &FluentWriter{network: network, addr: addr, opts: opts}
+	if err := w.connect(); err != nil {
+		return nil, err
+	}
+	w.batch = newBatcher(w, opts.BatchSize, opts.FlushInterval, opts.MaxBuffer, w.send)
+	return w, nil
+}
+
+func (w *FluentWriter) Write(r Record) error {
+	w.batch.add(r)
+	return nil
+}
+
+// Send all buffered records now
+func (w *FluentWriter) Flush() error {
+	return w.batch.flush()
+}
+
+// Flush the remaining records and close the connection
+func (w *FluentWriter) Close() error {
+	first, err := w.batch.stop()
+	if !first {
+		return nil
+	}
+
+	w.batch.sendMu.Lock()
+	defer w.batch.sendMu.Unlock()
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return err
+}
+
+func (w *FluentWriter) connect() error {
+	conn, err := net.Dial(w.network, w.addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	w.reader = bufio.NewReader(conn)
+	return nil
+}
+
+// send writes one message for the leading records of the batch sharing a tag and returns the others.
+// It reconnects with exponential backoff when the connection is gone.
+func (w *FluentWriter) send(batch []Record) ([]Record, error) {
+	if w.conn == nil {
+		if time.Now().Before(w.retryAt) {
+			return batch, errors.New("fluent: waiting to reconnect")
+		}
+		if err := w.connect(); err != nil {
+			w.failed()
+			return batch, err
+		}
+	}
+
+	message, chunk, count := w.encode(batch)
+	w.conn.SetDeadline(time.Now().Add(w.opts.AckTimeout))
+	if _, err := w.conn.Write(message); err != nil {
+		w.failed()
+		return batch, err
+	}
+
+	if w.opts.RequireAck {
+		response, err := msgpackDecode(w.reader)
+		if err != nil {
+			w.failed()
+			return batch, err
+		}
+		if ack, _ := response.(map[string]any); ack["ack"] != chunk {
+			w.failed()
+			return batch, errors.New("fluent: chunk was not acknowledged")
+		}
+	}
+
+	w.backoff = 0
+	return batch[count:], nil
+}
+
+func (w *FluentWriter) failed() {
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	w.backoff = min(max(2*w.backoff, 100*time.Millisecond), fluentMaxBackoff)
+	w.retryAt = time.Now().Add(w.backoff)
+}
+
+// encode builds a PackedForward message [tag, entries, option] from the leading records sharing a tag
+func (w *FluentWriter) encode(batch []Record) ([]byte, string, int) {
+	tag := w.tag(batch[0])
+	count := 1
+	for count < len(batch) && w.tag(batch[count]) == tag {
+		count++
+	}
+
+	var entries []byte
+	for _, r := range batch[:count] {
+		entries = msgpackAppendArrayHeader(entries, 2)
+		entries = msgpackAppend(entries, r.Time)
+		entries = msgpackAppend(entries, recordMap(r, w.opts.Fields))
+	}
+
+	var chunk string
+	option := map[string]any{"size": count}
+	if w.opts.RequireAck {
+		id := make([]byte, 16)
+		rand.Read(id)
+		chunk = base64.StdEncoding.EncodeToString(id)
+		option["chunk"] = chunk
+	}
+
+	message := msgpackAppendArrayHeader(nil, 3)
+	message = msgpackAppendString(message, tag)
+	message = msgpackAppendBinary(message, entries)
+	message = msgpackAppend(message, option)
+	return message, chunk, count
+}
+
+func (w *FluentWriter) tag(r Record) string {
+	if !w.opts.LevelTag {
+		return w.opts.Tag
+	}
+	return w.opts.Tag + "." + strings.ToLower(levelName(r.Level))
+}
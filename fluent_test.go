@@ -0,0 +1,168 @@
+package llog
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeFluentd accepts forward protocol connections and passes every message to messages
+type fakeFluentd struct {
+	listener net.Listener
+	messages chan []any
+	ack      bool
+	conns    chan net.Conn
+}
+
+func newFakeFluentd(t *testing.T, network, addr string, ack bool) *fakeFluentd {
+	t.Helper()
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &fakeFluentd{listener: listener, messages: make(chan []any, 100), ack: ack, conns: make(chan net.Conn, 10)}
+	go server.serve()
+	return server
+}
+
+func (s *fakeFluentd) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		s.conns <- conn
+		go func() {
+			reader := bufio.NewReader(conn)
+			for {
+				value, err := msgpackDecode(reader)
+				if err != nil {
+					return
+				}
+				message := value.([]any)
+				if option, _ := message[2].(map[string]any); s.ack && option["chunk"] != nil {
+					conn.Write(msgpackAppend(nil, map[string]any{"ack": option["chunk"]}))
+				}
+				s.messages <- message
+			}
+		}()
+	}
+}
+
+func (s *fakeFluentd) next(t *testing.T) []any {
+	t.Helper()
+	select {
+	case message := <-s.messages:
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatal("no message received")
+		return nil
+	}
+}
+
+// entries decodes the PackedForward event stream into its records
+func fluentEntries(t *testing.T, message []any) []map[string]any {
+	t.Helper()
+	reader := bytes.NewReader(message[1].([]byte))
+	var records []map[string]any
+	for reader.Len() > 0 {
+		entry, err := msgpackDecode(reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, entry.([]any)[1].(map[string]any))
+	}
+	return records
+}
+
+func TestFluentForward(t *testing.T) {
+	server := newFakeFluentd(t, "tcp", "127.0.0.1:0", true)
+	defer server.listener.Close()
+
+	if _, err := NewFluentWriter("udp", server.listener.Addr().String(), FluentOptions{}); err == nil {
+		t.Error("expected error for unsupported network")
+	}
+
+	writer, err := NewFluentWriter("tcp", server.listener.Addr().String(), FluentOptions{
+		Tag:           "app",
+		LevelTag:      true,
+		RequireAck:    true,
+		BatchSize:     3,
+		FlushInterval: time.Hour,
+		Fields:        map[string]any{"service": "llog"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	writer.Write(Record{Time: now, Level: LevelInfo, Message: "one", File: "main.go", Line: 3})
+	writer.Write(Record{Time: now, Level: LevelInfo, Message: "two"})
+	// Batch size reached, the background goroutine sends it split by tag
+	writer.Write(Record{Time: now, Level: LevelWarn, Message: "three", Fields: map[string]any{"user": "bob"}})
+
+	message := server.next(t)
+	if message[0] != "app.info" {
+		t.Errorf("unexpected tag %v", message[0])
+	}
+	if option := message[2].(map[string]any); option["size"] != int64(2) || option["chunk"] == nil {
+		t.Errorf("unexpected option %v", option)
+	}
+	records := fluentEntries(t, message)
+	if len(records) != 2 || records[0]["message"] != "one" || records[0]["file"] != "main.go" || records[0]["service"] != "llog" {
+		t.Errorf("unexpected records %v", records)
+	}
+
+	message = server.next(t)
+	records = fluentEntries(t, message)
+	if message[0] != "app.warn" || len(records) != 1 || records[0]["user"] != "bob" || records[0]["level"] != "Warn" {
+		t.Errorf("unexpected message %v %v", message[0], records)
+	}
+
+	if err := writer.Close(); err != nil {
+		t.Error(err)
+	}
+	if err := writer.Close(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFluentReconnect(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "fluent.sock")
+	server := newFakeFluentd(t, "unix", socket, false)
+
+	writer, err := NewFluentWriter("unix", socket, FluentOptions{FlushInterval: time.Hour, MaxBuffer: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	// Drop the connection and stop listening, the records stay buffered
+	(<-server.conns).Close()
+	server.listener.Close()
+	writer.Write(Record{Time: time.Now(), Message: "dropped"})
+	for writer.Flush() == nil {
+		// the first write after the peer closed may still succeed
+		writer.Write(Record{Time: time.Now(), Message: "dropped"})
+	}
+	writer.Write(Record{Time: time.Now(), Message: "kept one"})
+	writer.Write(Record{Time: time.Now(), Message: "kept two"})
+	if err := writer.Flush(); err == nil {
+		t.Error("expected flush to fail while waiting to reconnect")
+	}
+
+	server = newFakeFluentd(t, "unix", socket, false)
+	defer server.listener.Close()
+	writer.retryAt = time.Time{}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	records := fluentEntries(t, server.next(t))
+	if len(records) != 2 || records[0]["message"] != "kept one" || records[1]["message"] != "kept two" {
+		t.Errorf("unexpected records after reconnect %v", records)
+	}
+}
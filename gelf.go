@@ -0,0 +1,253 @@
+package llog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+type GELFCompression int
+
+const (
+	GELFCompressNone GELFCompression = iota
+	GELFCompressGzip
+	GELFCompressZlib
+)
+
+const (
+	gelfDefaultChunkSize = 1420
+	gelfMaxChunks        = 128
+	gelfChunkHeaderSize  = 12
+)
+
+var gelfChunkMagic = []byte{0x1e, 0x0f}
+
+// invalid characters for GELF additional field names
+var gelfFieldName = regexp.MustCompile(`[^\w.\-]`)
+
+// GELF levels are the syslog severities
+var gelfLevel = map[Level]int{
+	LevelTrace:    7,
+	LevelDebug:    7,
+	LevelInfo:     6,
+	LevelNotice:   5,
+	LevelWarn:     4,
+	LevelError:    3,
+	LevelCritical: 2,
+	LevelFatal:    2,
+	LevelPrint:    6,
+}
+
+type GELFOptions struct {
+	// Reported source host, defaults to os.Hostname()
+	Host string
+	// Compression of UDP datagrams. Graylog does not support compression over TCP.
+	Compression GELFCompression
+	// Maximum UDP datagram size including the chunk header, defaults to 1420
+	ChunkSize int
+	// Additional fields added to every message. The "_" prefix is added automatically.
+	Fields map[string]any
+}
+
+// GELFWriter is a Sink sending GELF 1.1 messages to Graylog over UDP or TCP
+type GELFWriter struct {
+	mu      sync.Mutex
+	network string
+	addr    string
+	conn    net.Conn // nil while a tcp collector is unreachable
+	closed  bool
+	opts    GELFOptions
+}
+
+// Connect to a Graylog GELF input. network is "udp" or "tcp" (or their 4/6 variants).
+func NewGELFWriter(network string, addr string, opts GELFOptions) (*GELFWriter, error) {
+	isTCP := strings.HasPrefix(network, "tcp")
+	if !isTCP && !strings.HasPrefix(network, "udp") {
+		return nil, errors.New("gelf: unsupported network " + network)
+	}
+	if isTCP && opts.Compression != GELFCompressNone {
+		return nil, errors.New("gelf: compression is not supported over tcp")
+	}
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	if opts.ChunkSize == 0 {
+		opts.ChunkSize = gelfDefaultChunkSize
+	}
+	if opts.ChunkSize <= gelfChunkHeaderSize {
+		return nil, errors.New("gelf: chunk size too small")
+	}
+
+	conn, err := net.Dial(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GELFWriter{network: network, addr: addr, conn: conn, opts: opts}, nil
+}
+
+func (w *GELFWriter) Write(r Record) error {
+	payload, err := w.encode(r)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return net.ErrClosed
+	}
+
+	if strings.HasPrefix(w.network, "tcp") {
+		return w.writeTCP(append(payload, 0))
+	}
+	return w.writeUDP(payload)
+}
+
+func (w *GELFWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+	err := w.conn.Close()
+	w.conn = nil
+	return err
+}
+
+func (w *GELFWriter) encode(r Record) ([]byte, error) {
+	message := map[string]any{
+		"version":       "1.1",
+		"host":          w.opts.Host,
+		"short_message": r.Message,
+		"timestamp":     epochSeconds(r.Time),
+		"level":         gelfSyslogLevel(r.Level),
+	}
+
+	// Multiline messages keep their first line as summary
+	if short, _, multiline := strings.Cut(r.Message, "\n"); multiline {
+		message["short_message"] = short
+		message["full_message"] = r.Message
+	}
+
+	for key, value := range w.opts.Fields {
+		addGELFField(message, key, value)
+	}
+	for key, value := range r.Fields {
+		addGELFField(message, key, value)
+	}
+	if r.File != "" {
+		message["_file"] = r.File
+		message["_line"] = r.Line
+	}
+	if len(r.Stack) > 0 {
+		message["full_message"] = r.Message + "\n" + r.Stack.String()
+	}
+
+	payload, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	switch w.opts.Compression {
+	case GELFCompressGzip:
+		zw := gzip.NewWriter(&buf)
+		zw.Write(payload)
+		err = zw.Close()
+	case GELFCompressZlib:
+		zw := zlib.NewWriter(&buf)
+		zw.Write(payload)
+		err = zw.Close()
+	default:
+		return payload, nil
+	}
+	return buf.Bytes(), err
+}
+
+func addGELFField(message map[string]any, key string, value any) {
+	key = gelfFieldName.ReplaceAllString(strings.TrimPrefix(key, "_"), "_")
+	// "_id" is reserved by Graylog
+	if key == "" || key == "id" {
+		return
+	}
+	message["_"+key] = value
+}
+
+// writeTCP reconnects once if the peer dropped the connection, and on every write while it is unreachable
+func (w *GELFWriter) writeTCP(payload []byte) error {
+	if w.conn != nil {
+		if _, err := w.conn.Write(payload); err == nil {
+			return nil
+		}
+		w.conn.Close()
+		w.conn = nil
+	}
+
+	conn, err := net.Dial(w.network, w.addr)
+	if err != nil {
+		return err
+	}
+	w.conn = conn
+	_, err = conn.Write(payload)
+	return err
+}
+
+func (w *GELFWriter) writeUDP(payload []byte) error {
+	if len(payload) <= w.opts.ChunkSize {
+		_, err := w.conn.Write(payload)
+		return err
+	}
+
+	dataSize := w.opts.ChunkSize - gelfChunkHeaderSize
+	count := (len(payload) + dataSize - 1) / dataSize
+	if count > gelfMaxChunks {
+		return errors.New("gelf: message exceeds " + strconv.Itoa(gelfMaxChunks) + " chunks")
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, 0, w.opts.ChunkSize)
+	for seq := range count {
+		end := min((seq+1)*dataSize, len(payload))
+		chunk = append(chunk[:0], gelfChunkMagic...)
+		chunk = append(chunk, id...)
+		chunk = append(chunk, byte(seq), byte(count))
+		chunk = append(chunk, payload[seq*dataSize:end]...)
+		if _, err := w.conn.Write(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// gelfSyslogLevel maps custom levels to the syslog severity of the closest builtin level below them
+func gelfSyslogLevel(level Level) int {
+	if syslog, ok := gelfLevel[level]; ok {
+		return syslog
+	}
+	severity := levelDefinition(level).Severity
+	syslog := 7
+	for builtin, builtinSyslog := range gelfLevel {
+		if builtin != LevelPrint && levelDefinition(builtin).Severity <= severity && builtinSyslog < syslog {
+			syslog = builtinSyslog
+		}
+	}
+	return syslog
+}
@@ -0,0 +1,237 @@
+package llog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readGELFDatagram(t *testing.T, conn net.PacketConn) []byte {
+	t.Helper()
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf[:n]
+}
+
+func TestGELFUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	writer, err := NewGELFWriter("udp", listener.LocalAddr().String(), GELFOptions{
+		Host:   "testhost",
+		Fields: map[string]any{"service": "llog", "id": "dropped"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	AddSink(writer)
+	defer RemoveSink(writer)
+	stdout = io.Discard
+	Warn("first line\nsecond line")
+	stdout = os.Stdout
+
+	var message map[string]any
+	if err := json.Unmarshal(readGELFDatagram(t, listener), &message); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"version":       "1.1",
+		"host":          "testhost",
+		"short_message": "first line",
+		"full_message":  "first line\nsecond line",
+		"level":         float64(4),
+		"_service":      "llog",
+		"_file":         "gelf_test.go",
+	}
+	for key, value := range expected {
+		if message[key] != value {
+			t.Errorf("%s: expected %v got %v", key, value, message[key])
+		}
+	}
+	if _, ok := message["_id"]; ok {
+		t.Error("reserved field _id was sent")
+	}
+	if _, ok := message["_line"]; !ok {
+		t.Error("missing _line")
+	}
+}
+
+func TestGELFChunked(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	for _, compression := range []GELFCompression{GELFCompressGzip, GELFCompressZlib} {
+		writer, err := NewGELFWriter("udp", listener.LocalAddr().String(), GELFOptions{
+			Compression: compression,
+			ChunkSize:   512,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// random data does not compress, forcing multiple chunks
+		random := make([]byte, 1500)
+		rand.Read(random)
+		text := hex.EncodeToString(random)
+		if err := writer.Write(Record{Time: time.Now(), Level: LevelInfo, Message: text}); err != nil {
+			t.Fatal(err)
+		}
+		writer.Close()
+
+		var payload []byte
+		var count int
+		for seq := 0; count == 0 || seq < count; seq++ {
+			chunk := readGELFDatagram(t, listener)
+			if !bytes.Equal(chunk[:2], gelfChunkMagic) {
+				t.Fatalf("chunk %d has no magic bytes", seq)
+			}
+			if int(chunk[10]) != seq {
+				t.Fatalf("chunk out of order: expected %d got %d", seq, chunk[10])
+			}
+			count = int(chunk[11])
+			payload = append(payload, chunk[gelfChunkHeaderSize:]...)
+		}
+		if count < 2 {
+			t.Errorf("expected multiple chunks, got %d", count)
+		}
+
+		var reader io.Reader
+		if compression == GELFCompressGzip {
+			reader, err = gzip.NewReader(bytes.NewReader(payload))
+		} else {
+			reader, err = zlib.NewReader(bytes.NewReader(payload))
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		var message map[string]any
+		if err := json.NewDecoder(reader).Decode(&message); err != nil {
+			t.Fatal(err)
+		}
+		if message["short_message"] != text {
+			t.Error("reassembled message does not match")
+		}
+	}
+}
+
+func TestGELFTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	if _, err := NewGELFWriter("tcp", listener.Addr().String(), GELFOptions{Compression: GELFCompressGzip}); err == nil {
+		t.Error("expected error for compression over tcp")
+	}
+	if _, err := NewGELFWriter("unix", listener.Addr().String(), GELFOptions{}); err == nil {
+		t.Error("expected error for unsupported network")
+	}
+
+	writer, err := NewGELFWriter("tcp", listener.Addr().String(), GELFOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	writer.Write(Record{Time: time.Now(), Level: LevelError, Message: "one", Fields: map[string]any{"user name": "bob"}})
+	writer.Write(Record{Time: time.Now(), Level: LevelDebug, Message: "two"})
+	writer.Close()
+	if err := writer.Write(Record{Message: "closed"}); err == nil {
+		t.Error("expected error writing to closed writer")
+	}
+
+	reader := bufio.NewReader(conn)
+	for _, expected := range []string{"one", "two"} {
+		frame, err := reader.ReadString(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var message map[string]any
+		if err := json.Unmarshal([]byte(strings.TrimSuffix(frame, "\x00")), &message); err != nil {
+			t.Fatal(err)
+		}
+		if message["short_message"] != expected {
+			t.Errorf("expected %q got %v", expected, message["short_message"])
+		}
+		if expected == "one" && message["_user_name"] != "bob" {
+			t.Errorf("expected sanitized field _user_name, got %v", message)
+		}
+	}
+}
+
+func TestGELFTCPReconnect(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := listener.Addr().String()
+	writer, err := NewGELFWriter("tcp", addr, GELFOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	conn, err := listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The collector goes down, writes fail until it is back
+	conn.Close()
+	listener.Close()
+	failed := 0
+	for i := 0; i < 10 && failed < 2; i++ {
+		if err := writer.Write(Record{Time: time.Now(), Message: "lost"}); err != nil {
+			failed++
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if failed < 2 {
+		t.Fatal("expected writes to fail while the collector is down")
+	}
+
+	listener, err = net.Listen("tcp", addr)
+	if err != nil {
+		t.Skip("address not reusable: ", err)
+	}
+	defer listener.Close()
+	if err := writer.Write(Record{Time: time.Now(), Message: "delivered"}); err != nil {
+		t.Fatalf("write after the collector came back failed: %v", err)
+	}
+	conn, err = listener.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	frame, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil || !strings.Contains(frame, `"short_message":"delivered"`) {
+		t.Errorf("unexpected frame %q, %v", frame, err)
+	}
+}
@@ -0,0 +1,325 @@
+// Package grpclog provides gRPC interceptors logging every call with llog.
+// It is separate from llog so only programs using gRPC depend on it.
+package grpclog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/blockyblockling/llog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Metadata key carrying the request id between services, the gRPC equivalent of X-Request-ID
+const requestIDKey = "x-request-id"
+
+type Options struct {
+	// Log request and response messages, truncated to this many bytes. 0 disables payload logging.
+	// Stream messages are logged individually at Debug level.
+	MaxPayloadSize int
+	// Level of a finished call by status code, defaults to Info for OK, Warn for errors caused by the client
+	// and Error for all others
+	Level func(code codes.Code) llog.Level
+	// Calls not logged, e.g. health checks. The request id is still propagated.
+	Skip func(fullMethod string) bool
+}
+
+func (opts *Options) defaults() {
+	if opts.Level == nil {
+		opts.Level = codeLevel
+	}
+	if opts.Skip == nil {
+		opts.Skip = func(string) bool { return false }
+	}
+}
+
+// Return a server interceptor logging every unary call with method, code, duration and peer.
+// The request id is taken from the incoming metadata or generated and stored in the context.
+func UnaryServerInterceptor(opts Options) grpc.UnaryServerInterceptor {
+	opts.defaults()
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx = serverContext(ctx)
+		resp, err := handler(ctx, req)
+		if opts.Skip(info.FullMethod) {
+			return resp, err
+		}
+
+		fields := callFields(ctx, "server", info.FullMethod, err, start)
+		if opts.MaxPayloadSize > 0 {
+			fields = append(fields, "request", payload(req, opts.MaxPayloadSize))
+			if err == nil {
+				fields = append(fields, "response", payload(resp, opts.MaxPayloadSize))
+			}
+		}
+		logCall(ctx, opts, info.FullMethod, err, fields)
+		return resp, err
+	}
+}
+
+// Return a server interceptor logging every stream when it ends, like UnaryServerInterceptor
+func StreamServerInterceptor(opts Options) grpc.StreamServerInterceptor {
+	opts.defaults()
+	return func(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := serverContext(stream.Context())
+		wrapped := &serverStream{ServerStream: stream, ctx: ctx, opts: &opts}
+		err := handler(srv, wrapped)
+		if opts.Skip(info.FullMethod) {
+			return err
+		}
+
+		fields := callFields(ctx, "server", info.FullMethod, err, start)
+		fields = append(fields, "sent", wrapped.sent, "received", wrapped.received)
+		logCall(ctx, opts, info.FullMethod, err, fields)
+		return err
+	}
+}
+
+// Return a client interceptor logging every unary call with method, code, duration and peer.
+// The request id of the context is sent along in the metadata.
+func UnaryClientInterceptor(opts Options) grpc.UnaryClientInterceptor {
+	opts.defaults()
+	return func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, callOpts ...grpc.CallOption) error {
+		start := time.Now()
+		var remote peer.Peer
+		ctx = clientContext(ctx)
+		err := invoker(ctx, method, req, reply, cc, append(callOpts, grpc.Peer(&remote))...)
+		if opts.Skip(method) {
+			return err
+		}
+
+		fields := callFields(peer.NewContext(ctx, &remote), "client", method, err, start)
+		if opts.MaxPayloadSize > 0 {
+			fields = append(fields, "request", payload(req, opts.MaxPayloadSize))
+			if err == nil {
+				fields = append(fields, "response", payload(reply, opts.MaxPayloadSize))
+			}
+		}
+		logCall(ctx, opts, method, err, fields)
+		return err
+	}
+}
+
+// Return a client interceptor logging every stream once it ended: received to the end, failed,
+// answered for client streams or abandoned by canceling its context
+func StreamClientInterceptor(opts Options) grpc.StreamClientInterceptor {
+	opts.defaults()
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, callOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		ctx = clientContext(ctx)
+		stream, err := streamer(ctx, desc, cc, method, callOpts...)
+		wrapped := &clientStream{ClientStream: stream, ctx: ctx, opts: &opts, serverStreams: desc.ServerStreams, done: make(chan struct{})}
+		wrapped.finish = func(err error) {
+			if opts.Skip(method) {
+				return
+			}
+			// The stream context carries the peer, the grpc.Peer call option is filled concurrently on cancellation
+			fieldsCtx := ctx
+			if stream != nil {
+				fieldsCtx = stream.Context()
+			}
+			fields := callFields(fieldsCtx, "client", method, err, start)
+			fields = append(fields, "sent", wrapped.sent, "received", wrapped.received)
+			logCall(ctx, opts, method, err, fields)
+		}
+		if err != nil {
+			wrapped.end(err)
+			return nil, err
+		}
+		if ctx.Done() != nil {
+			go wrapped.watch()
+		}
+		return wrapped, nil
+	}
+}
+
+// serverContext stores the incoming or a new request id in ctx
+func serverContext(ctx context.Context) context.Context {
+	requestID := ""
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(requestIDKey); len(values) > 0 {
+			requestID = values[0]
+		}
+	}
+	return llog.WithRequestID(ctx, requestID)
+}
+
+// clientContext forwards the request id of ctx to the server
+func clientContext(ctx context.Context) context.Context {
+	requestID := llog.RequestID(ctx)
+	if requestID == "" {
+		return ctx
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok && len(md.Get(requestIDKey)) > 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, requestIDKey, requestID)
+}
+
+func callFields(ctx context.Context, kind string, method string, err error, start time.Time) []any {
+	fields := []any{
+		"grpc_kind", kind,
+		"grpc_method", method,
+		"grpc_code", status.Code(err).String(),
+		"duration_ms", float64(time.Since(start).Microseconds()) / 1000,
+	}
+	if remote, ok := peer.FromContext(ctx); ok && remote.Addr != nil {
+		fields = append(fields, "peer", remote.Addr.String())
+	}
+	if err != nil {
+		fields = append(fields, "error", status.Convert(err).Message())
+	}
+	return fields
+}
+
+func logCall(ctx context.Context, opts Options, method string, err error, fields []any) {
+	code := status.Code(err)
+	llog.FromContext(ctx).With(fields...).Log(opts.Level(code), "%s %s", method, code)
+}
+
+// payload encodes a message as JSON, cut off after max bytes
+func payload(message any, max int) string {
+	var encoded string
+	if m, ok := message.(proto.Message); ok {
+		data, err := protojson.Marshal(m)
+		if err != nil {
+			encoded = fmt.Sprint(message)
+		} else {
+			encoded = string(data)
+		}
+	} else {
+		encoded = fmt.Sprint(message)
+	}
+	if len(encoded) > max {
+		return encoded[:max] + "...(truncated)"
+	}
+	return encoded
+}
+
+// Map codes caused by the client to Warn and server side failures to Error
+func codeLevel(code codes.Code) llog.Level {
+	switch code {
+	case codes.OK:
+		return llog.LevelInfo
+	case codes.Canceled, codes.InvalidArgument, codes.NotFound, codes.AlreadyExists, codes.PermissionDenied,
+		codes.Unauthenticated, codes.ResourceExhausted, codes.FailedPrecondition, codes.Aborted, codes.OutOfRange:
+		return llog.LevelWarn
+	}
+	return llog.LevelError
+}
+
+// serverStream replaces the context and counts the messages of a server stream
+type serverStream struct {
+	grpc.ServerStream
+	ctx      context.Context
+	opts     *Options
+	sent     int
+	received int
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *serverStream) SendMsg(m any) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent++
+		logMessage(s.ctx, s.opts, "sent", m)
+	}
+	return err
+}
+
+func (s *serverStream) RecvMsg(m any) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		s.received++
+		logMessage(s.ctx, s.opts, "received", m)
+	}
+	return err
+}
+
+// clientStream counts the messages of a client stream and logs once it ends
+type clientStream struct {
+	grpc.ClientStream
+	ctx           context.Context
+	opts          *Options
+	serverStreams bool // false if the single response ends the call, e.g. for CloseAndRecv
+	mu            sync.Mutex
+	sent          int
+	received      int
+	finish        func(err error)
+	once          sync.Once
+	done          chan struct{}
+}
+
+func (s *clientStream) SendMsg(m any) error {
+	err := s.ClientStream.SendMsg(m)
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			s.end(err)
+		}
+		return err
+	}
+	s.mu.Lock()
+	s.sent++
+	s.mu.Unlock()
+	logMessage(s.ctx, s.opts, "sent", m)
+	return nil
+}
+
+func (s *clientStream) RecvMsg(m any) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			s.end(nil)
+		} else {
+			s.end(err)
+		}
+		return err
+	}
+	s.mu.Lock()
+	s.received++
+	s.mu.Unlock()
+	logMessage(s.ctx, s.opts, "received", m)
+	if !s.serverStreams {
+		s.end(nil)
+	}
+	return nil
+}
+
+// watch ends streams abandoned by the caller once their context is canceled
+func (s *clientStream) watch() {
+	select {
+	case <-s.ctx.Done():
+		s.end(status.FromContextError(s.ctx.Err()).Err())
+	case <-s.done:
+	}
+}
+
+func (s *clientStream) end(err error) {
+	s.once.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.finish(err)
+	})
+}
+
+func logMessage(ctx context.Context, opts *Options, direction string, m any) {
+	if opts.MaxPayloadSize <= 0 {
+		return
+	}
+	llog.FromContext(ctx).With("direction", direction, "payload", payload(m, opts.MaxPayloadSize)).Debug("stream message")
+}
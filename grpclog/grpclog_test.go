@@ -0,0 +1,351 @@
+package grpclog
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blockyblockling/llog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// recordSink collects the records written by the server goroutines
+type recordSink struct {
+	mu      sync.Mutex
+	records []llog.Record
+}
+
+func (s *recordSink) Write(r llog.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	return nil
+}
+
+func (s *recordSink) snapshot() []llog.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]llog.Record(nil), s.records...)
+}
+
+func newSink(t *testing.T) *recordSink {
+	llog.SetLogLevel(llog.LevelDebug)
+	sink := &recordSink{}
+	llog.AddSink(sink)
+	t.Cleanup(func() { llog.RemoveSink(sink) })
+	return sink
+}
+
+// collectorDesc is a client streaming service summing up the health requests it receives
+var collectorDesc = grpc.ServiceDesc{
+	ServiceName: "test.Collector",
+	HandlerType: (*any)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName:    "Collect",
+		ClientStreams: true,
+		Handler: func(_ any, stream grpc.ServerStream) error {
+			var services []string
+			for {
+				var request healthpb.HealthCheckRequest
+				if err := stream.RecvMsg(&request); err == io.EOF {
+					break
+				} else if err != nil {
+					return err
+				}
+				services = append(services, request.Service)
+			}
+			return stream.SendMsg(&healthpb.HealthCheckRequest{Service: strings.Join(services, ",")})
+		},
+	}},
+}
+
+func newGRPCTest(t *testing.T, opts Options) *grpc.ClientConn {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(
+		grpc.UnaryInterceptor(UnaryServerInterceptor(opts)),
+		grpc.StreamInterceptor(StreamServerInterceptor(opts)),
+	)
+	healthpb.RegisterHealthServer(server, health.NewServer())
+	server.RegisterService(&collectorDesc, struct{}{})
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor(opts)),
+		grpc.WithStreamInterceptor(StreamClientInterceptor(opts)),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitRecords waits until the sink received n records, server side records are written after the response
+func waitRecords(t *testing.T, sink *recordSink, n int) []llog.Record {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		records := sink.snapshot()
+		if len(records) >= n {
+			return records
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d records, got %d", n, len(records))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+// waitRecord waits for the record of a call
+func waitRecord(t *testing.T, sink *recordSink, kind string, method string) llog.Record {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if record, ok := findRecord(sink.snapshot(), kind, method); ok {
+			return record
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("missing %s record of %s in %+v", kind, method, sink.snapshot())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func findRecord(records []llog.Record, kind string, method string) (llog.Record, bool) {
+	for _, record := range records {
+		if record.Fields["grpc_kind"] == kind && record.Fields["grpc_method"] == method {
+			return record, true
+		}
+	}
+	return llog.Record{}, false
+}
+
+func TestGRPCUnary(t *testing.T) {
+	sink := newSink(t)
+
+	client := healthpb.NewHealthClient(newGRPCTest(t, Options{MaxPayloadSize: 12}))
+	ctx := llog.WithContext(context.Background(), "request_id", "req-7")
+
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	records := waitRecords(t, sink, 2)
+
+	for _, kind := range []string{"server", "client"} {
+		record, ok := findRecord(records, kind, "/grpc.health.v1.Health/Check")
+		if !ok {
+			t.Fatalf("missing %s record in %+v", kind, records)
+		}
+		if record.Level != llog.LevelInfo || record.Message != "/grpc.health.v1.Health/Check OK" {
+			t.Errorf("unexpected %s record %v %q", kind, record.Level, record.Message)
+		}
+		if record.Fields["grpc_code"] != "OK" || record.Fields["peer"] != "bufconn" || record.Fields["request_id"] != "req-7" {
+			t.Errorf("unexpected %s fields %v", kind, record.Fields)
+		}
+		if _, ok := record.Fields["duration_ms"].(float64); !ok {
+			t.Errorf("missing duration in %v", record.Fields)
+		}
+		if record.Fields["request"] != "{}" || record.Fields["response"] != `{"status":"S...(truncated)` {
+			t.Errorf("unexpected payloads %q, %q", record.Fields["request"], record.Fields["response"])
+		}
+	}
+
+	// Client errors are logged as warnings, server failures as errors
+	_, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"})
+	if status.Code(err) != codes.NotFound {
+		t.Fatalf("expected NotFound, got %v", err)
+	}
+	conn := newGRPCTest(t, Options{})
+	err = conn.Invoke(context.Background(), "/grpc.health.v1.Health/Missing", &healthpb.HealthCheckRequest{}, &healthpb.HealthCheckResponse{})
+	if status.Code(err) != codes.Unimplemented {
+		t.Fatalf("expected Unimplemented, got %v", err)
+	}
+	records = waitRecords(t, sink, 5)
+
+	notFound, _ := findRecord(records[2:], "server", "/grpc.health.v1.Health/Check")
+	if notFound.Level != llog.LevelWarn || notFound.Fields["grpc_code"] != "NotFound" || notFound.Fields["error"] != "unknown service" {
+		t.Errorf("unexpected record %v %v", notFound.Level, notFound.Fields)
+	}
+	if id, _ := notFound.Fields["request_id"].(string); len(id) != 36 {
+		t.Errorf("expected generated request id, got %q", id)
+	}
+	unimplemented, _ := findRecord(records, "client", "/grpc.health.v1.Health/Missing")
+	if unimplemented.Level != llog.LevelError || unimplemented.Fields["grpc_code"] != "Unimplemented" {
+		t.Errorf("unexpected record %v %v", unimplemented.Level, unimplemented.Fields)
+	}
+	if _, ok := unimplemented.Fields["request"]; ok {
+		t.Error("payload logged without MaxPayloadSize")
+	}
+}
+
+func TestGRPCStream(t *testing.T) {
+	sink := newSink(t)
+
+	client := healthpb.NewHealthClient(newGRPCTest(t, Options{MaxPayloadSize: 100}))
+	ctx, cancel := context.WithCancel(llog.WithContext(context.Background(), "request_id", "req-8"))
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Recv(); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := stream.Recv(); status.Code(err) != codes.Canceled {
+		t.Fatalf("expected Canceled, got %v", err)
+	}
+
+	method := "/grpc.health.v1.Health/Watch"
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		records := sink.snapshot()
+		server, serverOK := findRecord(records, "server", method)
+		client, clientOK := findRecord(records, "client", method)
+		if serverOK && clientOK {
+			if server.Level != llog.LevelWarn || server.Fields["sent"] != 1 || server.Fields["received"] != 1 || server.Fields["request_id"] != "req-8" {
+				t.Errorf("unexpected server record %v %v", server.Level, server.Fields)
+			}
+			if client.Level != llog.LevelWarn || client.Fields["grpc_code"] != "Canceled" || client.Fields["sent"] != 1 || client.Fields["received"] != 1 {
+				t.Errorf("unexpected client record %v %v", client.Level, client.Fields)
+			}
+
+			var messages []string
+			for _, record := range records {
+				if record.Message == "stream message" {
+					messages = append(messages, record.Fields["direction"].(string)+" "+record.Fields["payload"].(string))
+				}
+			}
+			// each side sends and receives the request and the status
+			if len(messages) != 4 || !strings.Contains(strings.Join(messages, ","), `received {"status":"SERVING"}`) {
+				t.Errorf("unexpected stream messages %v", messages)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("missing stream records in %+v", records)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestGRPCSkip(t *testing.T) {
+	sink := newSink(t)
+
+	client := healthpb.NewHealthClient(newGRPCTest(t, Options{
+		Skip: func(method string) bool { return strings.HasPrefix(method, "/grpc.health.v1.") },
+	}))
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := client.Watch(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.Recv()
+	cancel()
+	stream.Recv()
+	time.Sleep(50 * time.Millisecond)
+
+	if records := sink.snapshot(); len(records) != 0 {
+		t.Errorf("skipped calls logged: %+v", records)
+	}
+}
+
+func TestGRPCClientStream(t *testing.T) {
+	sink := newSink(t)
+	conn := newGRPCTest(t, Options{})
+	method := "/test.Collector/Collect"
+
+	// CloseAndRecv: the single response ends the call without another RecvMsg
+	stream, err := conn.NewStream(context.Background(), &collectorDesc.Streams[0], method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, service := range []string{"a", "b", "c"} {
+		if err := stream.SendMsg(&healthpb.HealthCheckRequest{Service: service}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+	var response healthpb.HealthCheckRequest
+	if err := stream.RecvMsg(&response); err != nil || response.Service != "a,b,c" {
+		t.Fatalf("unexpected response %v, %v", response.Service, err)
+	}
+
+	client := waitRecord(t, sink, "client", method)
+	if client.Level != llog.LevelInfo || client.Fields["grpc_code"] != "OK" || client.Fields["sent"] != 3 || client.Fields["received"] != 1 {
+		t.Errorf("unexpected client record %v %v", client.Level, client.Fields)
+	}
+	server := waitRecord(t, sink, "server", method)
+	if server.Fields["grpc_code"] != "OK" || server.Fields["received"] != 3 || server.Fields["sent"] != 1 {
+		t.Errorf("unexpected server record %v", server.Fields)
+	}
+}
+
+func TestGRPCAbandonedStream(t *testing.T) {
+	sink := newSink(t)
+	conn := newGRPCTest(t, Options{})
+	method := "/test.Collector/Collect"
+
+	// The caller gives up without receiving, canceling the context ends the call
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := conn.NewStream(ctx, &collectorDesc.Streams[0], method)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stream.SendMsg(&healthpb.HealthCheckRequest{Service: "a"}); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	client := waitRecord(t, sink, "client", method)
+	if client.Level != llog.LevelWarn || client.Fields["grpc_code"] != "Canceled" || client.Fields["sent"] != 1 {
+		t.Errorf("unexpected client record %v %v", client.Level, client.Fields)
+	}
+	time.Sleep(20 * time.Millisecond)
+	count := 0
+	for _, record := range sink.snapshot() {
+		if record.Fields["grpc_kind"] == "client" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("expected one client record, got %d", count)
+	}
+}
+
+func TestGRPCPayload(t *testing.T) {
+	if payload := payload("plain", 10); payload != "plain" {
+		t.Errorf("unexpected payload %q", payload)
+	}
+	if payload := payload(&healthpb.HealthCheckRequest{Service: "svc"}, 100); payload != `{"service":"svc"}` {
+		t.Errorf("unexpected payload %q", payload)
+	}
+	for code, level := range map[codes.Code]llog.Level{
+		codes.OK:                 llog.LevelInfo,
+		codes.InvalidArgument:    llog.LevelWarn,
+		codes.PermissionDenied:   llog.LevelWarn,
+		codes.Internal:           llog.LevelError,
+		codes.Unavailable:        llog.LevelError,
+		codes.DeadlineExceeded:   llog.LevelError,
+		codes.FailedPrecondition: llog.LevelWarn,
+	} {
+		if codeLevel(code) != level {
+			t.Errorf("%s: expected level %v, got %v", code, level, codeLevel(code))
+		}
+	}
+}
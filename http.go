@@ -0,0 +1,160 @@
+package llog
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	httpDefaultRequestIDHeader = "X-Request-ID"
+	httpMaxRequestIDLength     = 128
+)
+
+type HTTPOptions struct {
+	// Header carrying the request id, defaults to "X-Request-ID"
+	RequestIDHeader string
+	// Always generate a new request id instead of using the one sent by the client
+	IgnoreIncomingRequestID bool
+	// Level of the access log by status code, defaults to Error for 5xx, Warn for 4xx and Info otherwise
+	Level func(status int) Level
+	// Requests not logged, e.g. health checks. The request id is still set.
+	Skip func(r *http.Request) bool
+}
+
+// Return a middleware logging every request with method, path, status, bytes, duration and remote address.
+// Each request gets a request id, taken from the request header or generated, which is returned in the response
+// header and stored in the request context, so FromContext(r.Context()) logs with the request_id field.
+func HTTPMiddleware(opts HTTPOptions) func(http.Handler) http.Handler {
+	if opts.RequestIDHeader == "" {
+		opts.RequestIDHeader = httpDefaultRequestIDHeader
+	}
+	if opts.Level == nil {
+		opts.Level = httpStatusLevel
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			requestID := r.Header.Get(opts.RequestIDHeader)
+			if opts.IgnoreIncomingRequestID || !validRequestID(requestID) {
+				requestID = newUUID()
+			}
+			w.Header().Set(opts.RequestIDHeader, requestID)
+			r = r.WithContext(WithContext(r.Context(), "request_id", requestID))
+
+			recorder := &statusRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			if opts.Skip != nil && opts.Skip(r) {
+				return
+			}
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+
+			logger := FromContext(r.Context()).With(
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", recorder.status,
+				"bytes", recorder.bytes,
+				"duration_ms", float64(time.Since(start).Microseconds())/1000,
+				"remote_addr", r.RemoteAddr,
+			)
+			logger.Log(opts.Level(recorder.status), "%s %s %d", r.Method, r.URL.Path, recorder.status)
+		})
+	}
+}
+
+// Return the request id stored in ctx by HTTPMiddleware, or an empty string
+func RequestID(ctx context.Context) string {
+	logger, _ := ctx.Value(contextKey{}).(*Logger)
+	if logger == nil {
+		return ""
+	}
+	id, _ := logger.fields["request_id"].(string)
+	return id
+}
+
+// Return a copy of ctx with id as request_id field, or a generated id if id is empty or unsafe to log.
+// For middlewares of other protocols, like the gRPC interceptors of llog/grpclog.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	if !validRequestID(id) {
+		id = newUUID()
+	}
+	return WithContext(ctx, "request_id", id)
+}
+
+func httpStatusLevel(status int) Level {
+	switch {
+	case status >= 500:
+		return LevelError
+	case status >= 400:
+		return LevelWarn
+	}
+	return LevelInfo
+}
+
+// validRequestID only accepts short printable ids, so clients cannot inject arbitrary content into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > httpMaxRequestIDLength {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// statusRecorder captures the status code and the number of body bytes written
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	// informational responses are followed by the final status
+	if w.status == 0 && status >= 200 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusRecorder) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func (w *statusRecorder) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Hijack hands the connection to handlers like WebSocket upgraders.
+// The access log shows status 101 unless the handler wrote another one before.
+func (w *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, rw, err
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (w *statusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,197 @@
+package llog
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHTTPMiddleware(t *testing.T) {
+	SetLogLevel(LevelDebug)
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	var handlerRequestID string
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ok", func(w http.ResponseWriter, r *http.Request) {
+		handlerRequestID = RequestID(r.Context())
+		FromContext(r.Context()).Info("handling")
+		io.WriteString(w, "hello")
+	})
+	mux.HandleFunc("/missing", func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "not found", http.StatusNotFound)
+	})
+	mux.HandleFunc("/broken", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusEarlyHints)
+		w.WriteHeader(http.StatusBadGateway)
+		http.NewResponseController(w).Flush()
+	})
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {})
+	server := httptest.NewServer(HTTPMiddleware(HTTPOptions{
+		Skip: func(r *http.Request) bool { return r.URL.Path == "/health" },
+	})(mux))
+	defer server.Close()
+
+	get := func(path string, requestID string) *http.Response {
+		request, _ := http.NewRequest(http.MethodGet, server.URL+path, nil)
+		if requestID != "" {
+			request.Header.Set("X-Request-ID", requestID)
+		}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(io.Discard, response.Body)
+		response.Body.Close()
+		return response
+	}
+
+	// Incoming request ids are propagated
+	response := get("/ok", "req-42")
+	if response.Header.Get("X-Request-ID") != "req-42" || handlerRequestID != "req-42" {
+		t.Errorf("request id not propagated: %q, %q", response.Header.Get("X-Request-ID"), handlerRequestID)
+	}
+	// Missing or invalid ones are replaced
+	response = get("/missing", "")
+	if len(response.Header.Get("X-Request-ID")) != 36 {
+		t.Errorf("expected generated request id, got %q", response.Header.Get("X-Request-ID"))
+	}
+	response = get("/broken", "bad id\twith spaces")
+	if id := response.Header.Get("X-Request-ID"); len(id) != 36 {
+		t.Errorf("expected generated request id, got %q", id)
+	}
+	get("/health", "")
+
+	if len(sink.records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(sink.records))
+	}
+	if sink.records[0].Message != "handling" || sink.records[0].Fields["request_id"] != "req-42" {
+		t.Errorf("request logger missing request id: %+v", sink.records[0])
+	}
+
+	expected := []struct {
+		level   Level
+		message string
+		status  int
+		bytes   int64
+	}{
+		{LevelInfo, "GET /ok 200", 200, 5},
+		{LevelWarn, "GET /missing 404", 404, 10},
+		{LevelError, "GET /broken 502", 502, 0},
+	}
+	for i, e := range expected {
+		record := sink.records[i+1]
+		if record.Level != e.level || record.Message != e.message {
+			t.Errorf("unexpected record %v %q", record.Level, record.Message)
+		}
+		if record.Fields["status"] != e.status || record.Fields["bytes"] != e.bytes || record.Fields["method"] != "GET" {
+			t.Errorf("unexpected fields %v", record.Fields)
+		}
+		if _, ok := record.Fields["duration_ms"].(float64); !ok {
+			t.Errorf("missing duration in %v", record.Fields)
+		}
+		if !strings.HasPrefix(record.Fields["remote_addr"].(string), "127.0.0.1:") {
+			t.Errorf("unexpected remote address %v", record.Fields["remote_addr"])
+		}
+		if record.Fields["request_id"] == nil {
+			t.Errorf("missing request id in %v", record.Fields)
+		}
+	}
+}
+
+func TestHTTPMiddlewareOptions(t *testing.T) {
+	SetLogLevel(LevelDebug)
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	handler := HTTPMiddleware(HTTPOptions{
+		RequestIDHeader:         "X-Correlation-ID",
+		IgnoreIncomingRequestID: true,
+		Level:                   func(int) Level { return LevelDebug },
+	})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	request := httptest.NewRequest(http.MethodPost, "/submit", nil)
+	request.Header.Set("X-Correlation-ID", "from-client")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+
+	if id := recorder.Header().Get("X-Correlation-ID"); id == "from-client" || id == "" {
+		t.Errorf("expected generated request id, got %q", id)
+	}
+	if len(sink.records) != 1 || sink.records[0].Level != LevelDebug || sink.records[0].Message != "POST /submit 200" {
+		t.Errorf("unexpected records %+v", sink.records)
+	}
+	if RequestID(request.Context()) != "" {
+		t.Error("request id outside of the middleware")
+	}
+}
+
+func TestHTTPMiddlewareHijack(t *testing.T) {
+	SetLogLevel(LevelDebug)
+	stdout = &syncBuffer{}
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	server := httptest.NewServer(HTTPMiddleware(HTTPOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, rw, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		defer conn.Close()
+		rw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\nhello")
+		rw.Flush()
+	})))
+	defer server.Close()
+
+	conn, err := net.Dial("tcp", server.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	io.WriteString(conn, "GET /ws HTTP/1.1\r\nHost: localhost\r\nUpgrade: websocket\r\nConnection: Upgrade\r\n\r\n")
+	data, _ := io.ReadAll(conn)
+	if !strings.HasPrefix(string(data), "HTTP/1.1 101 ") || !strings.HasSuffix(string(data), "hello") {
+		t.Errorf("unexpected response %q", data)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(sink.snapshot()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if records := sink.snapshot(); len(records) != 1 || records[0].Message != "GET /ws 101" {
+		t.Errorf("unexpected records %+v", records)
+	}
+
+	// Writers without connection report it instead of failing the type assertion
+	recorder := &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	if _, _, err := recorder.Hijack(); err != http.ErrNotSupported {
+		t.Errorf("unexpected error %v", err)
+	}
+}
+
+func TestWithRequestID(t *testing.T) {
+	if id := RequestID(WithRequestID(context.Background(), "req-1")); id != "req-1" {
+		t.Errorf("unexpected request id %q", id)
+	}
+	for _, invalid := range []string{"", "line\nbreak", strings.Repeat("a", 200)} {
+		if id := RequestID(WithRequestID(context.Background(), invalid)); len(id) != 36 || id == invalid {
+			t.Errorf("%q: expected generated request id, got %q", invalid, id)
+		}
+	}
+}
@@ -0,0 +1,604 @@
+package llog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// Minimal Kafka producer speaking the wire protocol directly.
+// Metadata v1 and Produce v3 (record batches v2) are supported by all brokers since 0.11.
+
+const (
+	kafkaAPIProduce         = 0
+	kafkaAPIMetadata        = 3
+	kafkaProduceVersion     = 3
+	kafkaMetadataVersion    = 1
+	kafkaDefaultClientID    = "llog"
+	kafkaDefaultTimeout     = 10 * time.Second
+	kafkaDefaultBatchSize   = 500
+	kafkaDefaultFlush       = time.Second
+	kafkaDefaultMaxBuffer   = 10000
+	kafkaRecordBatchVersion = 2
+	// Larger responses are not sent by a broker, e.g. an HTTP server answering on the port
+	kafkaMaxResponseSize = 100 << 20
+)
+
+type KafkaCompression int16
+
+const (
+	KafkaCompressNone KafkaCompression = 0
+	KafkaCompressGzip KafkaCompression = 1
+)
+
+var kafkaCRC = crc32.MakeTable(crc32.Castagnoli)
+
+var errKafkaShortResponse = errors.New("kafka: short response")
+
+var kafkaErrorName = map[int16]string{
+	2:  "CORRUPT_MESSAGE",
+	3:  "UNKNOWN_TOPIC_OR_PARTITION",
+	5:  "LEADER_NOT_AVAILABLE",
+	6:  "NOT_LEADER_OR_FOLLOWER",
+	7:  "REQUEST_TIMED_OUT",
+	10: "MESSAGE_TOO_LARGE",
+	13: "NETWORK_EXCEPTION",
+	19: "NOT_ENOUGH_REPLICAS",
+	20: "NOT_ENOUGH_REPLICAS_AFTER_APPEND",
+	29: "TOPIC_AUTHORIZATION_FAILED",
+	56: "KAFKA_STORAGE_ERROR",
+	87: "INVALID_RECORD",
+}
+
+// Error codes after which the records are kept and sent again
+var kafkaRetriable = map[int16]bool{2: true, 3: true, 5: true, 6: true, 7: true, 13: true, 19: true, 20: true, 56: true}
+
+type KafkaOptions struct {
+	// Topic all records are produced to
+	Topic string
+	// Record value used as partition key, e.g. "host", "level" or the name of a record field.
+	// Records without key are spread over the partitions batch by batch.
+	KeyField string
+	// Compression of the record batches
+	Compression KafkaCompression
+	// Wait for all in-sync replicas instead of only the leader
+	RequireAllAcks bool
+	// Timeout of a single request, defaults to 10s
+	Timeout time.Duration
+	// Client ID reported to the brokers, defaults to "llog"
+	ClientID string
+	// Records per produce request, defaults to 500
+	BatchSize int
+	// Maximum time a record is buffered before being sent, defaults to 1s
+	FlushInterval time.Duration
+	// Records kept while Kafka is unreachable, the oldest are dropped first. Defaults to 10000.
+	MaxBuffer int
+	// Additional fields added to every record
+	Fields map[string]any
+}
+
+// KafkaError is an error code returned by the broker for a partition
+type KafkaError struct {
+	Topic     string
+	Partition int32
+	Code      int16
+	// Number of records affected
+	Records int
+}
+
+func (e *KafkaError) Error() string {
+	name, ok := kafkaErrorName[e.Code]
+	if !ok {
+		name = "error code " + strconv.Itoa(int(e.Code))
+	}
+	return fmt.Sprintf("kafka: %s producing %d records to %s/%d", name, e.Records, e.Topic, e.Partition)
+}
+
+// Retriable errors keep the records buffered for the next attempt, the others drop them
+func (e *KafkaError) Retriable() bool {
+	return kafkaRetriable[e.Code]
+}
+
+// KafkaWriter is a Sink producing JSON encoded records to a Kafka topic.
+// Delivery errors are returned from Flush and reported to the sink error handler.
+type KafkaWriter struct {
+	brokers  []string
+	opts     KafkaOptions
+	hostname string
+	batch    *batcher
+
+	// guarded by batch.sendMu
+	conns       map[string]*kafkaConn
+	partitions  []int32
+	leaders     map[int32]string
+	next        int
+	correlation int32
+}
+
+type kafkaConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+}
+
+type kafkaMessage struct {
+	key   []byte
+	value []byte
+	time  time.Time
+}
+
+// Produce to topic on the cluster reachable through the bootstrap brokers ("host:port")
+func NewKafkaWriter(brokers []string, opts KafkaOptions) (*KafkaWriter, error) {
+	if len(brokers) == 0 {
+		return nil, errors.New("kafka: no brokers")
+	}
+	if opts.Topic == "" {
+		return nil, errors.New("kafka: topic is required")
+	}
+	if opts.Compression != KafkaCompressNone && opts.Compression != KafkaCompressGzip {
+		return nil, errors.New("kafka: unsupported compression")
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = kafkaDefaultTimeout
+	}
+	if opts.ClientID == "" {
+		opts.ClientID = kafkaDefaultClientID
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = kafkaDefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = kafkaDefaultFlush
+	}
+	if opts.MaxBuffer <= 0 {
+		opts.MaxBuffer = kafkaDefaultMaxBuffer
+	}
+
+	w := &KafkaWriter{brokers: brokers, opts: opts, conns: map[string]*kafkaConn{}}
+	w.hostname, _ = os.Hostname()
+	if err := w.refreshMetadata(); err != nil {
+		return nil, err
+	}
+	w.batch = newBatcher(w, opts.BatchSize, opts.FlushInterval, opts.MaxBuffer, w.send)
+	return w, nil
+}
+
+func (w *KafkaWriter) Write(r Record) error {
+	w.batch.add(r)
+	return nil
+}
+
+// Send all buffered records now
+func (w *KafkaWriter) Flush() error {
+	return w.batch.flush()
+}
+
+// Send the remaining records and close all broker connections
+func (w *KafkaWriter) Close() error {
+	first, err := w.batch.stop()
+	if !first {
+		return nil
+	}
+
+	w.batch.sendMu.Lock()
+	defer w.batch.sendMu.Unlock()
+	for addr := range w.conns {
+		w.closeConn(addr)
+	}
+	return err
+}
+
+func (w *KafkaWriter) send(batch []Record) ([]Record, error) {
+	if w.leaders == nil {
+		if err := w.refreshMetadata(); err != nil {
+			return batch, err
+		}
+	}
+
+	// Group the records by partition and the partitions by their leader
+	byPartition := map[int32][]int{}
+	unkeyed := w.partitions[w.next%len(w.partitions)]
+	w.next++
+	messages := make([]kafkaMessage, len(batch))
+	for i, r := range batch {
+		messages[i] = w.message(r)
+		partition := unkeyed
+		if messages[i].key != nil {
+			hash := kafkaMurmur2(messages[i].key) & 0x7fffffff
+			partition = w.partitions[int(hash)%len(w.partitions)]
+		}
+		byPartition[partition] = append(byPartition[partition], i)
+	}
+
+	var unsent []Record
+	var errs []error
+	byLeader := map[string][]int32{}
+	for partition, indices := range byPartition {
+		leader, ok := w.leaders[partition]
+		if !ok {
+			errs = append(errs, &KafkaError{Topic: w.opts.Topic, Partition: partition, Code: 5, Records: len(indices)})
+			for _, i := range indices {
+				unsent = append(unsent, batch[i])
+			}
+			continue
+		}
+		byLeader[leader] = append(byLeader[leader], partition)
+	}
+
+	for leader, partitions := range byLeader {
+		var request []byte
+		request = binary.BigEndian.AppendUint16(request, 0xffff) // no transactional id
+		if w.opts.RequireAllAcks {
+			request = binary.BigEndian.AppendUint16(request, 0xffff)
+		} else {
+			request = binary.BigEndian.AppendUint16(request, 1)
+		}
+		request = binary.BigEndian.AppendUint32(request, uint32(w.opts.Timeout.Milliseconds()))
+		request = binary.BigEndian.AppendUint32(request, 1)
+		request = kafkaAppendString(request, w.opts.Topic)
+		request = binary.BigEndian.AppendUint32(request, uint32(len(partitions)))
+		for _, partition := range partitions {
+			var partitionMessages []kafkaMessage
+			for _, i := range byPartition[partition] {
+				partitionMessages = append(partitionMessages, messages[i])
+			}
+			recordBatch := kafkaRecordBatch(partitionMessages, w.opts.Compression)
+			request = binary.BigEndian.AppendUint32(request, uint32(partition))
+			request = binary.BigEndian.AppendUint32(request, uint32(len(recordBatch)))
+			request = append(request, recordBatch...)
+		}
+
+		response, err := w.roundTrip(leader, kafkaAPIProduce, kafkaProduceVersion, request)
+		var partitionErrs []*KafkaError
+		if err == nil {
+			partitionErrs, err = produceErrors(response, byPartition)
+		}
+		if err != nil {
+			// No usable response, all partitions of this leader failed
+			w.leaders = nil
+			for _, partition := range partitions {
+				for _, i := range byPartition[partition] {
+					unsent = append(unsent, batch[i])
+				}
+			}
+			errs = append(errs, err)
+			continue
+		}
+
+		// Keep the records of failed partitions unless the broker rejected them permanently
+		for _, partitionErr := range partitionErrs {
+			if partitionErr.Retriable() {
+				w.leaders = nil
+				for _, i := range byPartition[partitionErr.Partition] {
+					unsent = append(unsent, batch[i])
+				}
+			}
+			errs = append(errs, partitionErr)
+		}
+	}
+
+	return unsent, errors.Join(errs...)
+}
+
+// produceErrors parses a produce response and returns the errors of all failed partitions
+func produceErrors(response *kafkaDecoder, byPartition map[int32][]int) ([]*KafkaError, error) {
+	var errs []*KafkaError
+	for range response.count() {
+		topic := response.string()
+		for range response.count() {
+			partition := response.int32()
+			code := response.int16()
+			response.int64() // base offset
+			response.int64() // log append time
+			if code != 0 {
+				errs = append(errs, &KafkaError{Topic: topic, Partition: partition, Code: code, Records: len(byPartition[partition])})
+			}
+		}
+	}
+	return errs, response.err
+}
+
+func (w *KafkaWriter) message(r Record) kafkaMessage {
+	fields := recordMap(r, w.opts.Fields)
+	fields["time"] = r.Time.Format(time.RFC3339Nano)
+	if _, ok := fields["host"]; !ok {
+		fields["host"] = w.hostname
+	}
+
+	var key []byte
+	if value, ok := fields[w.opts.KeyField]; ok && w.opts.KeyField != "" {
+		key = []byte(fmt.Sprint(value))
+	}
+
+	value, err := json.Marshal(fields)
+	if err != nil {
+		value, _ = json.Marshal(map[string]any{"level": levelName(r.Level), "message": r.Message, "error": err.Error()})
+	}
+	return kafkaMessage{key: key, value: value, time: r.Time}
+}
+
+// refreshMetadata looks up the partitions of the topic and their leaders
+func (w *KafkaWriter) refreshMetadata() error {
+	var request []byte
+	request = binary.BigEndian.AppendUint32(request, 1)
+	request = kafkaAppendString(request, w.opts.Topic)
+
+	var err error
+	for _, broker := range w.brokers {
+		var response *kafkaDecoder
+		response, err = w.roundTrip(broker, kafkaAPIMetadata, kafkaMetadataVersion, request)
+		if err != nil {
+			continue
+		}
+
+		nodes := map[int32]string{}
+		for range response.count() {
+			id := response.int32()
+			host := response.string()
+			port := response.int32()
+			response.string() // rack
+			nodes[id] = net.JoinHostPort(host, strconv.Itoa(int(port)))
+		}
+		response.int32() // controller
+
+		var partitions []int32
+		leaders := map[int32]string{}
+		for range response.count() {
+			code := response.int16()
+			name := response.string()
+			response.bool() // internal
+			for range response.count() {
+				response.int16() // partition error
+				partition := response.int32()
+				leader := response.int32()
+				response.skipArray(4) // replicas
+				response.skipArray(4) // isr
+				partitions = append(partitions, partition)
+				if addr, ok := nodes[leader]; ok {
+					leaders[partition] = addr
+				}
+			}
+			if name == w.opts.Topic && code != 0 {
+				err = &KafkaError{Topic: name, Partition: -1, Code: code}
+			}
+		}
+		if response.err != nil {
+			err = response.err
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if len(partitions) == 0 {
+			return errors.New("kafka: topic " + w.opts.Topic + " has no partitions")
+		}
+
+		// Brokers list the partitions in any order, keys select them by id like the Java client
+		slices.Sort(partitions)
+		w.partitions = partitions
+		w.leaders = leaders
+		return nil
+	}
+	return err
+}
+
+// roundTrip sends a request to the broker at addr and returns the response body
+func (w *KafkaWriter) roundTrip(addr string, apiKey int16, version int16, body []byte) (*kafkaDecoder, error) {
+	c, ok := w.conns[addr]
+	if !ok {
+		conn, err := net.DialTimeout("tcp", addr, w.opts.Timeout)
+		if err != nil {
+			return nil, err
+		}
+		c = &kafkaConn{conn: conn, reader: bufio.NewReader(conn)}
+		w.conns[addr] = c
+	}
+
+	w.correlation++
+	request := make([]byte, 4, 4+10+len(w.opts.ClientID)+len(body))
+	request = binary.BigEndian.AppendUint16(request, uint16(apiKey))
+	request = binary.BigEndian.AppendUint16(request, uint16(version))
+	request = binary.BigEndian.AppendUint32(request, uint32(w.correlation))
+	request = kafkaAppendString(request, w.opts.ClientID)
+	request = append(request, body...)
+	binary.BigEndian.PutUint32(request, uint32(len(request)-4))
+
+	c.conn.SetDeadline(time.Now().Add(w.opts.Timeout))
+	if _, err := c.conn.Write(request); err != nil {
+		w.closeConn(addr)
+		return nil, err
+	}
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(c.reader, header); err != nil {
+		w.closeConn(addr)
+		return nil, err
+	}
+	size := int(int32(binary.BigEndian.Uint32(header)))
+	if size < 4 || size > kafkaMaxResponseSize {
+		w.closeConn(addr)
+		return nil, fmt.Errorf("kafka: invalid response size %d", size)
+	}
+	response := make([]byte, size-4)
+	if _, err := io.ReadFull(c.reader, response); err != nil {
+		w.closeConn(addr)
+		return nil, err
+	}
+	if int32(binary.BigEndian.Uint32(header[4:])) != w.correlation {
+		w.closeConn(addr)
+		return nil, errors.New("kafka: unexpected correlation id")
+	}
+	return &kafkaDecoder{data: response}, nil
+}
+
+func (w *KafkaWriter) closeConn(addr string) {
+	if c, ok := w.conns[addr]; ok {
+		c.conn.Close()
+		delete(w.conns, addr)
+	}
+}
+
+// kafkaRecordBatch encodes messages as a v2 record batch
+func kafkaRecordBatch(messages []kafkaMessage, compression KafkaCompression) []byte {
+	first := messages[0].time.UnixMilli()
+	last := first
+	var records []byte
+	for i, m := range messages {
+		last = max(last, m.time.UnixMilli())
+
+		record := []byte{0} // attributes
+		record = binary.AppendVarint(record, m.time.UnixMilli()-first)
+		record = binary.AppendVarint(record, int64(i))
+		if m.key == nil {
+			record = binary.AppendVarint(record, -1)
+		} else {
+			record = binary.AppendVarint(record, int64(len(m.key)))
+			record = append(record, m.key...)
+		}
+		record = binary.AppendVarint(record, int64(len(m.value)))
+		record = append(record, m.value...)
+		record = binary.AppendVarint(record, 0) // headers
+
+		records = binary.AppendVarint(records, int64(len(record)))
+		records = append(records, record...)
+	}
+
+	if compression == KafkaCompressGzip {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		zw.Write(records)
+		zw.Close()
+		records = buf.Bytes()
+	}
+
+	// Everything after the crc field is covered by the checksum
+	var body []byte
+	body = binary.BigEndian.AppendUint16(body, uint16(compression))
+	body = binary.BigEndian.AppendUint32(body, uint32(len(messages)-1))
+	body = binary.BigEndian.AppendUint64(body, uint64(first))
+	body = binary.BigEndian.AppendUint64(body, uint64(last))
+	body = binary.BigEndian.AppendUint64(body, 0xffffffffffffffff) // producer id
+	body = binary.BigEndian.AppendUint16(body, 0xffff)             // producer epoch
+	body = binary.BigEndian.AppendUint32(body, 0xffffffff)         // base sequence
+	body = binary.BigEndian.AppendUint32(body, uint32(len(messages)))
+	body = append(body, records...)
+
+	var batch []byte
+	batch = binary.BigEndian.AppendUint64(batch, 0) // base offset
+	batch = binary.BigEndian.AppendUint32(batch, uint32(4+1+4+len(body)))
+	batch = binary.BigEndian.AppendUint32(batch, 0xffffffff) // partition leader epoch
+	batch = append(batch, kafkaRecordBatchVersion)
+	batch = binary.BigEndian.AppendUint32(batch, crc32.Checksum(body, kafkaCRC))
+	return append(batch, body...)
+}
+
+func kafkaAppendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// kafkaMurmur2 is the hash of the Java client's default partitioner, so keys map to the same partitions
+func kafkaMurmur2(data []byte) int32 {
+	const seed uint32 = 0x9747b28c
+	const m uint32 = 0x5bd1e995
+	length := len(data)
+	h := seed ^ uint32(length)
+
+	for i := 0; i+4 <= length; i += 4 {
+		k := binary.LittleEndian.Uint32(data[i:])
+		k *= m
+		k ^= k >> 24
+		k *= m
+		h *= m
+		h ^= k
+	}
+
+	tail := data[length&^3:]
+	switch len(tail) {
+	case 3:
+		h ^= uint32(tail[2]) << 16
+		fallthrough
+	case 2:
+		h ^= uint32(tail[1]) << 8
+		fallthrough
+	case 1:
+		h ^= uint32(tail[0])
+		h *= m
+	}
+
+	h ^= h >> 13
+	h *= m
+	h ^= h >> 15
+	return int32(h)
+}
+
+// kafkaDecoder reads big endian protocol fields. Errors are sticky and reported by err.
+type kafkaDecoder struct {
+	data []byte
+	err  error
+}
+
+func (d *kafkaDecoder) next(n int) []byte {
+	if d.err != nil || n < 0 || len(d.data) < n {
+		d.err = errKafkaShortResponse
+		// zeros for the fixed size fields, the lengths come from the response
+		return make([]byte, 8)
+	}
+	b := d.data[:n]
+	d.data = d.data[n:]
+	return b
+}
+
+func (d *kafkaDecoder) bool() bool {
+	return d.next(1)[0] != 0
+}
+
+func (d *kafkaDecoder) int16() int16 {
+	return int16(binary.BigEndian.Uint16(d.next(2)))
+}
+
+func (d *kafkaDecoder) int32() int32 {
+	return int32(binary.BigEndian.Uint32(d.next(4)))
+}
+
+func (d *kafkaDecoder) int64() int64 {
+	return int64(binary.BigEndian.Uint64(d.next(8)))
+}
+
+func (d *kafkaDecoder) string() string {
+	n := d.int16()
+	if n < 0 {
+		return ""
+	}
+	return string(d.next(int(n)))
+}
+
+// count reads the length of an array, 0 for null arrays or after an error.
+// Every element takes at least a byte, so larger counts are errors instead of billions of iterations.
+func (d *kafkaDecoder) count() int32 {
+	n := d.int32()
+	if d.err != nil || n < 0 {
+		return 0
+	}
+	if int(n) > len(d.data) {
+		d.err = errKafkaShortResponse
+		return 0
+	}
+	return n
+}
+
+func (d *kafkaDecoder) skipArray(elementSize int) {
+	if n := d.count(); n > 0 {
+		d.next(int(n) * elementSize)
+	}
+}
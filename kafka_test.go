@@ -0,0 +1,428 @@
+package llog
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKafka is an in-process broker answering Metadata v1 and Produce v3 requests
+type fakeKafka struct {
+	t          *testing.T
+	listener   net.Listener
+	topic      string
+	partitions int32
+	reversed   bool // list the partitions in the metadata in descending order
+
+	mu       sync.Mutex
+	messages map[int32][]kafkaMessage
+	failures map[int32]int16 // error returned once per partition
+	clientID string
+	acks     int16
+}
+
+func newFakeKafka(t *testing.T, topic string, partitions int32) *fakeKafka {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	broker := &fakeKafka{t: t, listener: listener, topic: topic, partitions: partitions, messages: map[int32][]kafkaMessage{}, failures: map[int32]int16{}}
+	go broker.serve()
+	return broker
+}
+
+func (b *fakeKafka) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		go func() {
+			defer conn.Close()
+			reader := bufio.NewReader(conn)
+			for {
+				size := make([]byte, 4)
+				if _, err := io.ReadFull(reader, size); err != nil {
+					return
+				}
+				request := make([]byte, binary.BigEndian.Uint32(size))
+				if _, err := io.ReadFull(reader, request); err != nil {
+					return
+				}
+				d := &kafkaDecoder{data: request}
+				apiKey := d.int16()
+				d.int16() // version
+				correlation := d.int32()
+				clientID := d.string()
+
+				var response []byte
+				switch apiKey {
+				case kafkaAPIMetadata:
+					response = b.metadata()
+				case kafkaAPIProduce:
+					b.mu.Lock()
+					b.clientID = clientID
+					b.mu.Unlock()
+					response = b.produce(d)
+				}
+
+				frame := binary.BigEndian.AppendUint32(nil, uint32(len(response)+4))
+				frame = binary.BigEndian.AppendUint32(frame, uint32(correlation))
+				conn.Write(append(frame, response...))
+			}
+		}()
+	}
+}
+
+func (b *fakeKafka) metadata() []byte {
+	host, port, _ := net.SplitHostPort(b.listener.Addr().String())
+	portNumber, _ := strconv.Atoi(port)
+
+	var r []byte
+	r = binary.BigEndian.AppendUint32(r, 1) // brokers
+	r = binary.BigEndian.AppendUint32(r, 0)
+	r = kafkaAppendString(r, host)
+	r = binary.BigEndian.AppendUint32(r, uint32(portNumber))
+	r = binary.BigEndian.AppendUint16(r, 0xffff) // rack
+	r = binary.BigEndian.AppendUint32(r, 0)      // controller
+	r = binary.BigEndian.AppendUint32(r, 1)      // topics
+	r = binary.BigEndian.AppendUint16(r, 0)
+	r = kafkaAppendString(r, b.topic)
+	r = append(r, 0)
+	r = binary.BigEndian.AppendUint32(r, uint32(b.partitions))
+	for i := range b.partitions {
+		partition := i
+		if b.reversed {
+			partition = b.partitions - 1 - i
+		}
+		r = binary.BigEndian.AppendUint16(r, 0)
+		r = binary.BigEndian.AppendUint32(r, uint32(partition))
+		r = binary.BigEndian.AppendUint32(r, 0) // leader
+		r = binary.BigEndian.AppendUint32(r, 1) // replicas
+		r = binary.BigEndian.AppendUint32(r, 0)
+		r = binary.BigEndian.AppendUint32(r, 1) // isr
+		r = binary.BigEndian.AppendUint32(r, 0)
+	}
+	return r
+}
+
+func (b *fakeKafka) produce(d *kafkaDecoder) []byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d.string() // transactional id
+	b.acks = d.int16()
+	d.int32() // timeout
+
+	var r []byte
+	topics := d.int32()
+	r = binary.BigEndian.AppendUint32(r, uint32(topics))
+	for range topics {
+		topic := d.string()
+		r = kafkaAppendString(r, topic)
+		partitions := d.int32()
+		r = binary.BigEndian.AppendUint32(r, uint32(partitions))
+		for range partitions {
+			partition := d.int32()
+			batch := d.next(int(d.int32()))
+
+			code, failing := b.failures[partition]
+			if failing {
+				delete(b.failures, partition)
+			} else {
+				b.messages[partition] = append(b.messages[partition], decodeKafkaBatch(b.t, batch)...)
+			}
+			r = binary.BigEndian.AppendUint32(r, uint32(partition))
+			r = binary.BigEndian.AppendUint16(r, uint16(code))
+			r = binary.BigEndian.AppendUint64(r, 0)
+			r = binary.BigEndian.AppendUint64(r, 0xffffffffffffffff)
+		}
+	}
+	return binary.BigEndian.AppendUint32(r, 0) // throttle
+}
+
+func decodeKafkaBatch(t *testing.T, batch []byte) []kafkaMessage {
+	d := &kafkaDecoder{data: batch}
+	d.int64() // base offset
+	if int(d.int32()) != len(d.data) {
+		t.Error("invalid batch length")
+	}
+	d.int32() // leader epoch
+	if d.next(1)[0] != kafkaRecordBatchVersion {
+		t.Error("invalid magic")
+	}
+	crc := uint32(d.int32())
+	if crc32.Checksum(d.data, kafkaCRC) != crc {
+		t.Error("invalid crc")
+	}
+	attributes := d.int16()
+	d.int32() // last offset delta
+	first := d.int64()
+	d.int64()
+	d.int64()
+	d.int16()
+	d.int32()
+	count := d.int32()
+
+	records := d.data
+	if attributes&7 == int16(KafkaCompressGzip) {
+		reader, err := gzip.NewReader(bytes.NewReader(records))
+		if err != nil {
+			t.Fatal(err)
+		}
+		records, _ = io.ReadAll(reader)
+	}
+
+	var messages []kafkaMessage
+	reader := bytes.NewReader(records)
+	for range count {
+		binary.ReadVarint(reader) // length
+		reader.ReadByte()         // attributes
+		delta, _ := binary.ReadVarint(reader)
+		binary.ReadVarint(reader) // offset delta
+
+		var m kafkaMessage
+		if keyLength, _ := binary.ReadVarint(reader); keyLength >= 0 {
+			m.key = make([]byte, keyLength)
+			reader.Read(m.key)
+		}
+		valueLength, _ := binary.ReadVarint(reader)
+		m.value = make([]byte, valueLength)
+		reader.Read(m.value)
+		binary.ReadVarint(reader) // headers
+		m.time = time.UnixMilli(first + delta)
+		messages = append(messages, m)
+	}
+	return messages
+}
+
+func TestKafkaMurmur2(t *testing.T) {
+	// Values of the Java client's Utils.murmur2
+	expected := map[string]int32{
+		"21":                         -973932308,
+		"foobar":                     -790332482,
+		"a-little-bit-long-string":   -985981536,
+		"a-little-bit-longer-string": -1486304829,
+		"lkjh234lh9fiuh90y23oiuhsafujhadof229phr9h19h89h8": -58897971,
+		"abc": 479470107,
+	}
+	for key, hash := range expected {
+		if result := kafkaMurmur2([]byte(key)); result != hash {
+			t.Errorf("murmur2(%q): expected %d got %d", key, hash, result)
+		}
+	}
+}
+
+func TestKafka(t *testing.T) {
+	broker := newFakeKafka(t, "logs", 3)
+	defer broker.listener.Close()
+
+	if _, err := NewKafkaWriter(nil, KafkaOptions{Topic: "logs"}); err == nil {
+		t.Error("expected error without brokers")
+	}
+	if _, err := NewKafkaWriter([]string{broker.listener.Addr().String()}, KafkaOptions{}); err == nil {
+		t.Error("expected error without topic")
+	}
+	if _, err := NewKafkaWriter([]string{broker.listener.Addr().String()}, KafkaOptions{Topic: "logs", Compression: 4}); err == nil {
+		t.Error("expected error for unsupported compression")
+	}
+	if _, err := NewKafkaWriter([]string{"127.0.0.1:1"}, KafkaOptions{Topic: "logs"}); err == nil {
+		t.Error("expected error for unreachable broker")
+	}
+
+	writer, err := NewKafkaWriter([]string{"127.0.0.1:1", broker.listener.Addr().String()}, KafkaOptions{
+		Topic:          "logs",
+		KeyField:       "user",
+		Compression:    KafkaCompressGzip,
+		RequireAllAcks: true,
+		ClientID:       "tester",
+		FlushInterval:  time.Hour,
+		Fields:         map[string]any{"service": "llog"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	for _, user := range []string{"alice", "bob", "alice"} {
+		writer.Write(Record{Time: now, Level: LevelInfo, Message: "login", Fields: map[string]any{"user": user}})
+	}
+	writer.Write(Record{Time: now, Level: LevelWarn, Message: "no key", File: "main.go", Line: 3})
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Keys are partitioned like the Java client does
+	aliceHash := kafkaMurmur2([]byte("alice")) & 0x7fffffff
+	alicePartition := aliceHash % 3
+	if len(broker.messages[alicePartition]) < 2 {
+		t.Errorf("expected both alice records in partition %d, got %v", alicePartition, broker.messages)
+	}
+	total := 0
+	for _, messages := range broker.messages {
+		total += len(messages)
+		for _, m := range messages {
+			var value map[string]any
+			if err := json.Unmarshal(m.value, &value); err != nil {
+				t.Fatal(err)
+			}
+			if value["service"] != "llog" || value["host"] == nil || value["time"] == nil {
+				t.Errorf("unexpected value %v", value)
+			}
+			if value["user"] != nil && string(m.key) != value["user"] {
+				t.Errorf("unexpected key %q for %v", m.key, value)
+			}
+			if value["user"] == nil && m.key != nil {
+				t.Errorf("unexpected key for unkeyed record %q", m.key)
+			}
+			if !m.time.Equal(now.Truncate(time.Millisecond)) {
+				t.Errorf("unexpected timestamp %v", m.time)
+			}
+		}
+	}
+	if total != 4 || broker.clientID != "tester" || broker.acks != -1 {
+		t.Errorf("unexpected broker state: %d records, client %q, acks %d", total, broker.clientID, broker.acks)
+	}
+
+	writer.Close()
+	writer.Close()
+}
+
+func TestKafkaUnsortedMetadata(t *testing.T) {
+	broker := newFakeKafka(t, "logs", 4)
+	broker.reversed = true
+	defer broker.listener.Close()
+	writer, err := NewKafkaWriter([]string{broker.listener.Addr().String()}, KafkaOptions{Topic: "logs", KeyField: "user", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	users := []string{"alice", "bob", "carol", "dave", "erin", "frank"}
+	for _, user := range users {
+		writer.Write(Record{Time: time.Now(), Message: "login", Fields: map[string]any{"user": user}})
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	for _, user := range users {
+		expected := int32((kafkaMurmur2([]byte(user)) & 0x7fffffff) % 4)
+		found := false
+		for _, m := range broker.messages[expected] {
+			found = found || string(m.key) == user
+		}
+		if !found {
+			t.Errorf("expected %s in partition %d, got %v", user, expected, broker.messages)
+		}
+	}
+}
+
+func TestKafkaDeliveryErrors(t *testing.T) {
+	broker := newFakeKafka(t, "logs", 1)
+	defer broker.listener.Close()
+
+	writer, err := NewKafkaWriter([]string{broker.listener.Addr().String()}, KafkaOptions{Topic: "logs", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	// Retriable errors keep the records
+	broker.failures[0] = 6
+	writer.Write(Record{Time: time.Now(), Message: "retried"})
+	err = writer.Flush()
+	var kafkaErr *KafkaError
+	if !errors.As(err, &kafkaErr) || !kafkaErr.Retriable() || kafkaErr.Records != 1 {
+		t.Fatalf("expected retriable kafka error, got %v", err)
+	}
+	if err.Error() != "kafka: NOT_LEADER_OR_FOLLOWER producing 1 records to logs/0" {
+		t.Errorf("unexpected error message %q", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(broker.messages[0]) != 1 || broker.acks != 1 {
+		t.Errorf("expected record to be resent with leader acks, got %d", len(broker.messages[0]))
+	}
+
+	// Permanent errors drop them
+	broker.failures[0] = 10
+	writer.Write(Record{Time: time.Now(), Message: "too large"})
+	if err := writer.Flush(); !errors.As(err, &kafkaErr) || kafkaErr.Retriable() {
+		t.Fatalf("expected permanent kafka error, got %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(broker.messages[0]) != 1 {
+		t.Error("permanently failed record was resent")
+	}
+	if (&KafkaError{Code: 99}).Error() != "kafka: error code 99 producing 0 records to /0" {
+		t.Error("unexpected message for unknown error code")
+	}
+
+	// Lost connections keep the records until the broker is back
+	broker.listener.Close()
+	for addr := range writer.conns {
+		writer.conns[addr].conn.Close()
+	}
+	writer.Write(Record{Time: time.Now(), Message: "offline"})
+	if err := writer.Flush(); err == nil {
+		t.Error("expected error while broker is offline")
+	}
+	if len(writer.batch.pending) != 1 {
+		t.Errorf("expected record to stay buffered, got %d", len(writer.batch.pending))
+	}
+}
+
+func TestKafkaInvalidResponse(t *testing.T) {
+	for name, response := range map[string]string{
+		"too short": "\x00\x00\x00\x02\x00\x00\x00\x01",
+		"http":      "HTTP/1.1 400 Bad Request\r\n\r\n",
+	} {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go func() {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			conn.Read(make([]byte, 1024))
+			io.WriteString(conn, response)
+		}()
+		_, err = NewKafkaWriter([]string{listener.Addr().String()}, KafkaOptions{Topic: "logs", Timeout: time.Second})
+		if err == nil || !strings.Contains(err.Error(), "invalid response size") {
+			t.Errorf("%s: unexpected error %v", name, err)
+		}
+		listener.Close()
+	}
+
+	// Counts larger than the response end decoding instead of looping over them
+	response := &kafkaDecoder{data: []byte{0x7f, 0xff, 0xff, 0xff, 0x00, 0x01}}
+	if _, err := produceErrors(response, nil); err != errKafkaShortResponse {
+		t.Errorf("unexpected error %v", err)
+	}
+	replicas := &kafkaDecoder{data: []byte{0x7f, 0xff, 0xff, 0xff}}
+	replicas.skipArray(4)
+	if replicas.err != errKafkaShortResponse {
+		t.Errorf("unexpected error %v", replicas.err)
+	}
+}
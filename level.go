@@ -0,0 +1,192 @@
+package llog
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// LevelDefinition describes how a level is named, ordered and printed
+type LevelDefinition struct {
+	// Name used by GetLevelByName and the structured encoders, e.g. "Notice"
+	Name string
+	// Short tag of the console and text output, e.g. "NOTE". Levels without a tag print the plain message.
+	Tag string
+	// Color of the tag in the console
+	Color Color
+	// Color of the message in the console, empty keeps the terminal default
+	MessageColor Color
+	// Ordering of the levels. A record is shown if its severity is at least the one of the current level.
+	Severity int
+	// Print the caller location in the console
+	Location bool
+	// Capture a stack trace, printed under the message and added to the records of the sinks
+	Stack bool
+	// Additional names accepted by ParseLevel, e.g. "warning"
+	Aliases []string
+}
+
+var levelsMu sync.Mutex
+
+// levels is replaced as a whole on registration, so logging reads it without locking
+var levels = newLevelRegistry()
+
+func newLevelRegistry() *atomic.Pointer[map[Level]LevelDefinition] {
+	registry := &atomic.Pointer[map[Level]LevelDefinition]{}
+	registry.Store(&map[Level]LevelDefinition{
+		LevelTrace:          {Name: "Trace", Tag: "TRAC", Color: DarkGray, Severity: 10},
+		LevelDebug:          {Name: "Debug", Tag: "DEBU", Color: bold + Blue, Severity: 20, Aliases: []string{"dbg"}},
+		LevelDebugWithStack: {Name: "DebugWithStack", Tag: "DEBU", Color: bold + Blue, Severity: 20, Location: true},
+		LevelInfo:           {Name: "Info", Tag: "INFO", Color: LightGreen, Severity: 30, Aliases: []string{"information"}},
+		LevelNotice:         {Name: "Notice", Tag: "NOTE", Color: Cyan, Severity: 35},
+		LevelWarn:           {Name: "Warn", Tag: "WARN", Color: Yellow, MessageColor: Yellow, Severity: 40, Location: true, Aliases: []string{"warning"}},
+		LevelError:          {Name: "Error", Tag: "ERR", Color: Red, MessageColor: Red, Severity: 50, Location: true, Aliases: []string{"err"}},
+		LevelCritical:       {Name: "Critical", Tag: "CRIT", Color: bold + LightRed, MessageColor: LightRed, Severity: 60, Location: true, Aliases: []string{"crit"}},
+		LevelFatal:          {Name: "Fatal", Tag: "FATAL", Color: bold + Red, MessageColor: bold + Red, Severity: 70, Location: true},
+		LevelPrint:          {Name: "Print", Severity: 100},
+	})
+	return registry
+}
+
+// Register a custom level or redefine a builtin one. Names and aliases have to be unique.
+// Levels should be registered during initialization, before they are used for logging.
+func RegisterLevel(level Level, definition LevelDefinition) error {
+	if definition.Name == "" {
+		return errors.New("level name is required")
+	}
+
+	levelsMu.Lock()
+	defer levelsMu.Unlock()
+	current := *levels.Load()
+	for registered, existing := range current {
+		if registered == level {
+			continue
+		}
+		for _, name := range append([]string{definition.Name}, definition.Aliases...) {
+			if existing.matches(name) {
+				return errors.New("level name " + name + " is already registered")
+			}
+		}
+	}
+
+	updated := make(map[Level]LevelDefinition, len(current)+1)
+	for registered, existing := range current {
+		updated[registered] = existing
+	}
+	updated[level] = definition
+	levels.Store(&updated)
+	return nil
+}
+
+// Return all registered levels ordered by severity
+func Levels() []Level {
+	registered := *levels.Load()
+	all := make([]Level, 0, len(registered))
+	for level := range registered {
+		all = append(all, level)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if registered[all[i]].Severity != registered[all[j]].Severity {
+			return registered[all[i]].Severity < registered[all[j]].Severity
+		}
+		return all[i] < all[j]
+	})
+	return all
+}
+
+// Return the definition of a registered level
+func GetLevelDefinition(level Level) (LevelDefinition, bool) {
+	definition, ok := (*levels.Load())[level]
+	return definition, ok
+}
+
+// Parse a level by its name or alias, ignoring case, or by its number
+func ParseLevel(name string) (Level, error) {
+	name = strings.TrimSpace(name)
+	registered := *levels.Load()
+	for level, definition := range registered {
+		if definition.matches(name) {
+			return level, nil
+		}
+	}
+	if number, err := strconv.Atoi(name); err == nil {
+		if _, ok := registered[Level(number)]; ok {
+			return Level(number), nil
+		}
+	}
+	return 0, errors.New("Level not found: " + name)
+}
+
+func (definition LevelDefinition) matches(name string) bool {
+	if strings.EqualFold(definition.Name, name) {
+		return true
+	}
+	for _, alias := range definition.Aliases {
+		if strings.EqualFold(alias, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// String returns the name of the level, or its number if it is not registered
+func (l Level) String() string {
+	if definition, ok := GetLevelDefinition(l); ok {
+		return definition.Name
+	}
+	return strconv.Itoa(int(l))
+}
+
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+	level, err := ParseLevel(string(text))
+	if err != nil {
+		return err
+	}
+	*l = level
+	return nil
+}
+
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// UnmarshalJSON accepts names and numbers
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		var number json.Number
+		if json.Unmarshal(data, &number) != nil {
+			return err
+		}
+		name = number.String()
+	}
+	return l.UnmarshalText([]byte(name))
+}
+
+// Set implements flag.Value, e.g. flag.Var(&level, "level", "log level")
+func (l *Level) Set(name string) error {
+	return l.UnmarshalText([]byte(name))
+}
+
+// levelDefinition returns the definition of a level, unregistered levels print the plain message
+func levelDefinition(level Level) LevelDefinition {
+	return (*levels.Load())[level]
+}
+
+func levelName(level Level) string {
+	return levelDefinition(level).Name
+}
+
+// levelNameFormatted returns the colored console tag of a level
+func levelNameFormatted(level Level) string {
+	definition := levelDefinition(level)
+	return string(definition.Color) + definition.Tag + reset
+}
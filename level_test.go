@@ -0,0 +1,230 @@
+package llog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestLevelOrdering(t *testing.T) {
+	var names []string
+	for _, level := range Levels() {
+		names = append(names, levelName(level))
+	}
+	expected := "Trace,Debug,DebugWithStack,Info,Notice,Warn,Error,Critical,Fatal,Print"
+	if strings.Join(names, ",") != expected {
+		t.Errorf("unexpected order %v", names)
+	}
+
+	for _, name := range []string{"Trace", "Notice", "Critical", "Print"} {
+		level, err := GetLevelByName(name)
+		if err != nil || levelName(level) != name {
+			t.Errorf("%s: got %v, %v", name, level, err)
+		}
+	}
+}
+
+func TestNewLevels(t *testing.T) {
+	SetLogLevel(LevelInfo)
+	defer SetLogLevel(LevelDebug)
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	Trace("hidden")
+	Notice("notice")
+	Critical("critical")
+	Log(LevelTrace, "hidden")
+	Log(LevelNotice, "log notice")
+	logger := FromContext(context.Background())
+	logger.Trace("hidden")
+	logger.Notice("logger notice")
+	logger.Critical("logger critical")
+	ctx := context.Background()
+	TraceCtx(ctx, "hidden")
+	NoticeCtx(ctx, "ctx notice")
+	CriticalCtx(ctx, "ctx critical")
+	LogCtx(ctx, LevelCritical, "ctx log")
+
+	var messages []string
+	for _, record := range sink.records {
+		messages = append(messages, levelName(record.Level)+" "+record.Message)
+	}
+	expected := "Notice notice,Critical critical,Notice log notice,Notice logger notice,Critical logger critical," +
+		"Notice ctx notice,Critical ctx critical,Critical ctx log"
+	if strings.Join(messages, ",") != expected {
+		t.Errorf("unexpected records %v", messages)
+	}
+
+	lines := strings.Split(buf.String(), "\n")
+	notice := regexp.MustCompile(`^` + timestampRegex + ` \x1b\[36mNOTE` + resetRegex + ` notice` + resetRegex + `$`)
+	if !notice.MatchString(lines[0]) {
+		t.Errorf("unexpected notice output %q", lines[0])
+	}
+	critical := regexp.MustCompile(`^` + timestampRegex + ` \x1b\[1m\x1b\[91mCRIT` + resetRegex + ` \x1b\[90mlevel_test\.go:\d+` + resetRegex + ` \x1b\[91mcritical` + resetRegex + `$`)
+	if !critical.MatchString(lines[1]) {
+		t.Errorf("unexpected critical output %q", lines[1])
+	}
+
+	SetLogLevel(LevelTrace)
+	Trace("trace")
+	if !strings.Contains(buf.String(), "TRAC"+reset+" trace") {
+		t.Errorf("trace not shown at trace level: %q", buf.String())
+	}
+}
+
+func TestRegisterLevel(t *testing.T) {
+	saved := levels.Load()
+	defer levels.Store(saved)
+	SetLogLevel(LevelInfo)
+	defer SetLogLevel(LevelDebug)
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	const LevelAudit Level = 100
+	if err := RegisterLevel(LevelAudit, LevelDefinition{Name: "Audit", Tag: "AUDT", Color: Magenta, Severity: 45}); err != nil {
+		t.Fatal(err)
+	}
+	if err := RegisterLevel(Level(101), LevelDefinition{Name: "audit"}); err == nil {
+		t.Error("duplicate name registered")
+	}
+	if err := RegisterLevel(Level(101), LevelDefinition{}); err == nil {
+		t.Error("level without name registered")
+	}
+
+	if level, err := GetLevelByName("Audit"); level != LevelAudit || err != nil {
+		t.Errorf("got %v, %v", level, err)
+	}
+	if definition, ok := GetLevelDefinition(LevelAudit); !ok || definition.Tag != "AUDT" {
+		t.Errorf("unexpected definition %+v", definition)
+	}
+	levels := Levels()
+	if levels[6] != LevelAudit {
+		t.Errorf("audit not ordered between Warn and Error: %v", levels)
+	}
+
+	Log(LevelAudit, "user deleted")
+	if !strings.Contains(buf.String(), string(Magenta)+"AUDT"+reset+" user deleted") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	// The severity decides what is shown
+	SetLogLevel(LevelAudit)
+	buf.Reset()
+	Warn("hidden")
+	Error("shown")
+	if strings.Contains(buf.String(), "hidden") || !strings.Contains(buf.String(), "shown") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	// Custom levels are encoded with their name and tag
+	record := Record{Time: time.Now(), Level: LevelAudit, Message: "m"}
+	if line, _ := TextEncoder(record); !strings.Contains(string(line), " AUDT m") {
+		t.Errorf("unexpected text %s", line)
+	}
+	if line, _ := JSONEncoder(record); !strings.Contains(string(line), `"level":"Audit"`) {
+		t.Errorf("unexpected json %s", line)
+	}
+	if gelfSyslogLevel(LevelAudit) != 4 || gelfSyslogLevel(LevelNotice) != 5 {
+		t.Errorf("unexpected syslog levels %d, %d", gelfSyslogLevel(LevelAudit), gelfSyslogLevel(LevelNotice))
+	}
+
+	// Redefining a builtin level keeps its name unique
+	if err := RegisterLevel(LevelInfo, LevelDefinition{Name: "Info", Tag: "INF", Color: Green, Severity: 30}); err != nil {
+		t.Error(err)
+	}
+	buf.Reset()
+	SetLogLevel(LevelInfo)
+	Info("changed")
+	if !strings.Contains(buf.String(), string(Green)+"INF"+reset+" changed") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	for name, expected := range map[string]Level{
+		"Info":     LevelInfo,
+		"INFO":     LevelInfo,
+		" debug ":  LevelDebug,
+		"warning":  LevelWarn,
+		"WARN":     LevelWarn,
+		"err":      LevelError,
+		"crit":     LevelCritical,
+		"print":    LevelPrint,
+		"trace":    LevelTrace,
+		"2":        LevelInfo,
+		"Critical": LevelCritical,
+	} {
+		level, err := ParseLevel(name)
+		if err != nil || level != expected {
+			t.Errorf("%q: got %v, %v", name, level, err)
+		}
+	}
+	for _, name := range []string{"", "verbose", "42", "-1"} {
+		if _, err := ParseLevel(name); err == nil {
+			t.Errorf("%q: expected error", name)
+		}
+	}
+
+	if LevelNotice.String() != "Notice" || Level(42).String() != "42" {
+		t.Errorf("unexpected strings %s, %s", LevelNotice, Level(42))
+	}
+}
+
+func TestLevelMarshaling(t *testing.T) {
+	var config struct {
+		Level   Level `json:"level" yaml:"level"`
+		Default Level `json:"default" yaml:"default"`
+	}
+
+	data, err := json.Marshal(map[string]Level{"level": LevelWarn})
+	if err != nil || string(data) != `{"level":"Warn"}` {
+		t.Errorf("unexpected json %s, %v", data, err)
+	}
+	if err := json.Unmarshal([]byte(`{"level":"warning","default":4}`), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Level != LevelWarn || config.Default != LevelError {
+		t.Errorf("unexpected levels %v, %v", config.Level, config.Default)
+	}
+	if err := json.Unmarshal([]byte(`{"level":"loud"}`), &config); err == nil {
+		t.Error("expected error for unknown level")
+	}
+	if err := json.Unmarshal([]byte(`{"level":true}`), &config); err == nil {
+		t.Error("expected error for invalid type")
+	}
+
+	if err := yaml.Unmarshal([]byte("level: NOTICE\ndefault: crit\n"), &config); err != nil {
+		t.Fatal(err)
+	}
+	if config.Level != LevelNotice || config.Default != LevelCritical {
+		t.Errorf("unexpected levels %v, %v", config.Level, config.Default)
+	}
+	if data, _ := yaml.Marshal(config); string(data) != "level: Notice\ndefault: Critical\n" {
+		t.Errorf("unexpected yaml %q", data)
+	}
+
+	level := LevelInfo
+	flags := flag.NewFlagSet("test", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	flags.Var(&level, "level", "log level")
+	if err := flags.Parse([]string{"-level", "debug"}); err != nil || level != LevelDebug {
+		t.Errorf("unexpected flag level %v, %v", level, err)
+	}
+	if err := flags.Parse([]string{"-level", "loud"}); err == nil {
+		t.Error("expected flag error")
+	}
+}
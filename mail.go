@@ -6,6 +6,7 @@ import (
 
 var mail_from string
 var mail_to []string
+var mail_subject string
 var mail_dial gomail.Dialer
 
 func NotifyMail(msg any, a ...any) error {
@@ -14,13 +15,18 @@ func NotifyMail(msg any, a ...any) error {
 
 	mailMessage.SetHeader("From", mail_from)
 	mailMessage.SetHeader("To", mail_to...)
-	mailMessage.SetHeader("Subject", "LLog Notification!")
+	mailMessage.SetHeader("Subject", mail_subject)
 	mailMessage.SetBody("text/plain", message)
 	return mail_dial.DialAndSend(mailMessage)
 }
 
+// Set up NotifyMail. An empty subject defaults to "LLog Notification!".
 func InitMail(from string, to []string, host string, port int, user string, password string, subject string) {
 	mail_dial = *gomail.NewDialer(host, port, user, password)
 	mail_from = from
 	mail_to = to
+	mail_subject = subject
+	if mail_subject == "" {
+		mail_subject = "LLog Notification!"
+	}
 }
@@ -1,14 +1,14 @@
 package llog
 
 import (
-	"errors"
 	"fmt"
 	"io"
 	"os"
 	"regexp"
-	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 )
 
@@ -22,25 +22,12 @@ const (
 	LevelError
 	LevelFatal
 	LevelPrint
+	// Ordered by their severity in the level registry, not by their value
+	LevelTrace
+	LevelNotice
+	LevelCritical
 )
 
-var levelName = map[Level]string{
-	LevelDebug: "Debug",
-	LevelInfo:  "Info",
-	LevelWarn:  "Warn",
-	LevelError: "Error",
-	LevelFatal: "Fatal",
-	LevelPrint: "Print",
-}
-
-var levelNameFormatted = map[Level]string{
-	LevelDebug: bold + string(Blue) + "DEBU" + reset,
-	LevelInfo:  string(LightGreen) + "INFO" + reset,
-	LevelWarn:  string(Yellow) + "WARN" + reset,
-	LevelError: string(Red) + "ERR" + reset,
-	LevelFatal: bold + string(Red) + "FATAL" + reset,
-}
-
 type Color string
 
 const (
@@ -66,7 +53,11 @@ const (
 )
 
 var stdout io.Writer = os.Stdout
-var currentLevel Level
+var currentLevel atomic.Int64
+var colorsDisabled atomic.Bool
+
+// ansiEscape matches the color sequences removed when colors are disabled
+var ansiEscape = regexp.MustCompile(`\x1b\[[0-9;]*m`)
 
 //TODO: Write README.md
 //TODO: Improve Logging
@@ -74,190 +65,201 @@ var currentLevel Level
 //TODO: Add Multiline indented Logging via Custom Function NextLine() to be implemented into the Loggers
 
 func SetLogLevel(level Level) {
-	currentLevel = level
+	currentLevel.Store(int64(level))
+}
+
+// Return the level set by SetLogLevel, safe for concurrent use
+func GetLogLevel() Level {
+	return Level(currentLevel.Load())
 }
 
+// Enable or disable the colors of the console output, enabled by default
+func SetColors(enabled bool) {
+	colorsDisabled.Store(!enabled)
+}
+
+// Look up a level by name, alias or number like ParseLevel
 func GetLevelByName(name string) (Level, error) {
-	switch name {
-	case levelName[LevelDebug]:
-		return LevelDebug, nil
-	case levelName[LevelInfo]:
-		return LevelInfo, nil
-	case levelName[LevelWarn]:
-		return LevelWarn, nil
-	case levelName[LevelError]:
-		return LevelError, nil
-	case levelName[LevelFatal]:
-		return LevelFatal, nil
-	default:
-		return 0, errors.New("Level not found")
-	}
+	return ParseLevel(name)
 }
 
 func Print(msg any, a ...any) {
-	printStdout(formatLogLevel(LevelPrint, msg, a...))
+	printStdout(formatLogLevel(LevelPrint, nil, msg, a...))
+	dispatch(LevelPrint, nil, msg, a...)
 }
 
 func Debug(msg any, a ...any) {
 	if showLevel(LevelDebug) {
-		printStdout(formatLogLevel(LevelDebug, msg, a...))
+		printStdout(formatLogLevel(LevelDebug, nil, msg, a...))
+		dispatch(LevelDebug, nil, msg, a...)
 	}
 }
 
 func DebugWithStack(msg any, a ...any) {
 	if showLevel(LevelDebug) {
-		printStdout(formatLogLevel(LevelDebugWithStack, msg, a...))
+		printStdout(formatLogLevel(LevelDebugWithStack, nil, msg, a...))
+		// recorded as Debug, with the stack trace if DebugWithStack captures one
+		dispatchRecord(LevelDebug, nil, 1, levelDefinition(LevelDebugWithStack).Stack, msg, a...)
+	}
+}
+
+func Trace(msg any, a ...any) {
+	if showLevel(LevelTrace) {
+		printStdout(formatLogLevel(LevelTrace, nil, msg, a...))
+		dispatch(LevelTrace, nil, msg, a...)
 	}
 }
 
 func Info(msg any, a ...any) {
 	if showLevel(LevelInfo) {
-		printStdout(formatLogLevel(LevelInfo, msg, a...))
+		printStdout(formatLogLevel(LevelInfo, nil, msg, a...))
+		dispatch(LevelInfo, nil, msg, a...)
+	}
+}
+
+func Notice(msg any, a ...any) {
+	if showLevel(LevelNotice) {
+		printStdout(formatLogLevel(LevelNotice, nil, msg, a...))
+		dispatch(LevelNotice, nil, msg, a...)
 	}
 }
 
 func Warn(msg any, a ...any) {
 	if showLevel(LevelWarn) {
-		printStdout(formatLogLevel(LevelWarn, msg, a...))
+		printStdout(formatLogLevel(LevelWarn, nil, msg, a...))
+		dispatch(LevelWarn, nil, msg, a...)
 	}
 }
 
 func Error(msg any, a ...any) {
 	if showLevel(LevelError) {
-		printStdout(formatLogLevel(LevelError, msg, a...))
+		printStdout(formatLogLevel(LevelError, nil, msg, a...))
+		dispatch(LevelError, nil, msg, a...)
+	}
+}
+
+// Critical logs failures more severe than errors without exiting like Fatal
+func Critical(msg any, a ...any) {
+	if showLevel(LevelCritical) {
+		printStdout(formatLogLevel(LevelCritical, nil, msg, a...))
+		dispatch(LevelCritical, nil, msg, a...)
 	}
 }
 
-// Recieve an Error with a possible Nil value. It will only log if err != nil
-// TODO: Add an optional attribute to add custom messages to the error
-func ErrNil(err error) (errNotNil bool) {
+// Log at a level chosen at runtime, including custom registered levels. LevelFatal does not exit.
+func Log(level Level, msg any, a ...any) {
+	if showLevel(level) {
+		printStdout(formatLogLevel(level, nil, msg, a...))
+		dispatch(level, nil, msg, a...)
+	}
+}
+
+// Recieve an Error with a possible Nil value. It will only log if err != nil.
+// An optional message is put in front of the error, e.g. ErrNil(err, "loading %s", path).
+// It is logged at Error unless the error suggests another level, see WithLevel. LevelFatal does not exit.
+func ErrNil(err error, a ...any) (errNotNil bool) {
 	if err != nil {
-		if showLevel(LevelError) {
-			printStdout(formatLogLevel(LevelError, err.Error()))
-		}
+		(&Logger{}).logErr(errorLevel(err, LevelError), 1, err, optionalMessage(a))
 		return true
 	}
 
 	return false
 }
 
+// Log err at Error with the message in front, e.g. ErrorErr(err, "loading %s", path).
+// The wrapped errors are listed below the message, their fields and stack trace are added to the record.
+func ErrorErr(err error, msg any, a ...any) {
+	(&Logger{}).logErr(LevelError, 1, err, formatMessage(msg, a...))
+}
+
 func Fatal(msg any, a ...any) {
 	if showLevel(LevelFatal) {
 		format := fmt.Sprint(msg)
-		printStdout(formatLogLevel(LevelFatal, format, a...))
+		printStdout(formatLogLevel(LevelFatal, nil, format, a...))
+		dispatch(LevelFatal, nil, format, a...)
 
 		//Exit
-		os.Exit(2) //using the same exit code as panic
+		fatalExit(formatMessage(format, a...))
 	}
 }
 
-func FatalNil(err error) (errNotNil bool) {
-	if showLevel(LevelFatal) && err != nil {
-		printStdout(formatLogLevel(LevelFatal, err.Error()))
-
+// Exit like Fatal if err != nil, with an optional message in front like ErrNil
+func FatalNil(err error, a ...any) (errNotNil bool) {
+	if err != nil && (&Logger{}).logErr(LevelFatal, 1, err, optionalMessage(a)) {
 		//Exit
-		os.Exit(2) //using the same exit code as panic
+		fatalExit(errorMessage(optionalMessage(a), err))
+		return true
 	}
 	return false
 }
 
 func PrintNoNewLine(level Level, msg any, a ...any) {
 	if showLevel(level) {
-		printStdout("\r", strings.TrimSuffix(formatLogLevel(level, msg, a...), "\n"))
+		printStdout("\r", strings.TrimSuffix(formatLogLevel(level, nil, msg, a...), "\n"))
 	}
 }
 
 func ReplaceLine(level Level, msg any, a ...any) {
 	if showLevel(level) {
-		printStdout("\r", strings.TrimSuffix(formatLogLevel(level, msg, a...), "\n"))
+		printStdout("\r", strings.TrimSuffix(formatLogLevel(level, nil, msg, a...), "\n"))
 	}
 }
 
-func formatLogLevel(level Level, msg any, a ...any) string {
-	stackLocatorIndex := 3
-	message := formatMessage(msg, a...)
-	switch level {
-	case LevelDebug:
-		return fmt.Sprint(
-			timestamp(),
-			" ",
-			levelNameFormatted[LevelDebug],
-			" ",
-			message,
-			reset,
-			"\n",
-		)
-	case LevelDebugWithStack:
-		return fmt.Sprint(
-			timestamp(),
-			" ",
-			levelNameFormatted[LevelDebug],
-			" ",
-			stackLoc(stackLocatorIndex),
-			" ",
-			message,
-			reset,
-			"\n",
-		)
-	case LevelInfo:
-		return fmt.Sprint(
-			timestamp(),
-			" ",
-			levelNameFormatted[LevelInfo],
-			" ",
-			message,
-			reset,
-			"\n",
-		)
-	case LevelWarn:
-		return fmt.Sprint(
-			timestamp(),
-			" ",
-			levelNameFormatted[LevelWarn],
-			" ",
-			stackLoc(stackLocatorIndex),
-			" ",
-			Yellow,
-			message,
-			reset,
-			"\n",
-		)
-	case LevelError:
-		return fmt.Sprint(
-			timestamp(),
-			" ",
-			levelNameFormatted[LevelError],
-			" ",
-			stackLoc(stackLocatorIndex),
-			" ",
-			Red,
-			message,
-			reset,
-			"\n",
-		)
-	case LevelFatal:
-		return fmt.Sprint(
-			timestamp(),
-			" ",
-			levelNameFormatted[LevelFatal],
-			" ",
-			stackLoc(3),
-			" ",
-			bold,
-			Red,
-			message,
-			reset,
-			"\n",
-		)
+func formatLogLevel(level Level, fields map[string]any, msg any, a ...any) string {
+	return formatLogLevelSkip(level, fields, 2, msg, a...)
+}
+
+// formatLogLevelSkip formats with the location skip frames above its caller
+func formatLogLevelSkip(level Level, fields map[string]any, skip int, msg any, a ...any) string {
+	return formatLogLevelStack(level, fields, skip+1, false, msg, a...)
+}
+
+// formatLogLevelStack is formatLogLevelSkip also adding a stack trace if stack is set
+func formatLogLevelStack(level Level, fields map[string]any, skip int, stack bool, msg any, a ...any) string {
+	var details []string
+	if stack || levelDefinition(level).Stack {
+		details = append(details, captureStack(skip+1).String())
+	}
+	return formatLogLevelDetails(level, fields, skip+1, details, msg, a...)
+}
+
+// formatLogLevelDetails is formatLogLevelSkip adding lines like error chains and stack traces below the message
+func formatLogLevelDetails(level Level, fields map[string]any, skip int, details []string, msg any, a ...any) string {
+	stackLocatorIndex := skip + 2
+	message := formatMessage(msg, a...) + formatFields(fields)
+	definition := levelDefinition(level)
+	if definition.Tag == "" {
+		//Default print
+		return fmt.Sprint(message, reset, "\n")
 	}
 
-	//Default print
-	return fmt.Sprint(message, reset, "\n")
+	var components []any
+	if stamp := timestamp(); stamp != "" {
+		components = append(components, stamp, " ")
+	}
+	components = append(components, levelNameFormatted(level), " ")
+	if definition.Location {
+		components = append(components, stackLoc(stackLocatorIndex), " ")
+	}
+	components = append(components, definition.MessageColor, message, reset)
+	for _, detail := range details {
+		components = append(components, "\n", DarkGray, detail, reset)
+	}
+	return fmt.Sprint(append(components, "\n")...)
 }
 
 func showLevel(level Level) bool {
-	return currentLevel <= level
+	return showLevelSkip(level, 2)
+}
 
+// showLevelSkip checks level against the threshold of the call site skip frames above its caller,
+// which is the current level unless a vmodule override matches
+func showLevelSkip(level Level, skip int) bool {
+	threshold := GetLogLevel()
+	if override, ok := vmoduleLevel(skip + 1); ok {
+		threshold = override
+	}
+	return levelDefinition(threshold).Severity <= levelDefinition(level).Severity
 }
 
 func formatMessage(msg any, a ...any) string {
@@ -274,24 +276,52 @@ func formatMessage(msg any, a ...any) string {
 	return fmt.Sprint(a...)
 }
 
+// formatFields renders fields as sorted key=value pairs in gray after the message
+func formatFields(fields map[string]any) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(reset + string(DarkGray))
+	for _, key := range keys {
+		b.WriteString(" " + key + "=" + textValue(fields[key]))
+	}
+	return b.String()
+}
+
 // TODO: Add an argument adding spaces between components
 func printStdout(components ...any) {
 	//Printing to Stdout
-	_, err := fmt.Fprint(stdout, components...)
+	var err error
+	if colorsDisabled.Load() {
+		_, err = io.WriteString(stdout, ansiEscape.ReplaceAllString(fmt.Sprint(components...), ""))
+	} else {
+		_, err = fmt.Fprint(stdout, components...)
+	}
 	if err != nil {
 		panic("Failed to print to Stdout")
 	}
 }
 
+// timestamp returns the console timestamp, empty if it is omitted
 func timestamp() string {
-	return string(DarkGray) + time.Now().Format("2006/01/02 15:04:05") + reset
+	stamp := consoleTimestampOptions().format(time.Now(), defaultTimeFormat)
+	if stamp == "" {
+		return ""
+	}
+	return string(DarkGray) + stamp + reset
 }
 
 func stackLoc(skip int) string {
-	cwd, _ := os.Getwd()
-	cwd += "/"
-	_, file, line, _ := runtime.Caller(skip)
-	fileLocal := strings.TrimPrefix(file, cwd)
-
+	fileLocal, line, function := callerLoc(skip)
+	if function != "" {
+		return string(DarkGray) + fileLocal + ":" + strconv.Itoa(line) + " " + function + reset
+	}
 	return string(DarkGray) + fileLocal + ":" + strconv.Itoa(line) + reset
 }
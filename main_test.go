@@ -85,11 +85,11 @@ const (
 	stackRegex     string = `\x1b\[90mmain_test\.go:\d+` + resetRegex
 )
 
-var debugRegex string = strings.ReplaceAll(levelNameFormatted[LevelDebug], `[`, `\[`)
-var infoRegex string = strings.ReplaceAll(levelNameFormatted[LevelInfo], `[`, `\[`)
-var warnRegex string = strings.ReplaceAll(levelNameFormatted[LevelWarn], `[`, `\[`)
-var errorRegex string = strings.ReplaceAll(levelNameFormatted[LevelError], `[`, `\[`)
-var fatalRegex string = strings.ReplaceAll(levelNameFormatted[LevelFatal], `[`, `\[`)
+var debugRegex string = strings.ReplaceAll(levelNameFormatted(LevelDebug), `[`, `\[`)
+var infoRegex string = strings.ReplaceAll(levelNameFormatted(LevelInfo), `[`, `\[`)
+var warnRegex string = strings.ReplaceAll(levelNameFormatted(LevelWarn), `[`, `\[`)
+var errorRegex string = strings.ReplaceAll(levelNameFormatted(LevelError), `[`, `\[`)
+var fatalRegex string = strings.ReplaceAll(levelNameFormatted(LevelFatal), `[`, `\[`)
 
 func Formatter(t *testing.T) {
 	var result string
@@ -0,0 +1,342 @@
+package llog
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"time"
+)
+
+// Minimal MessagePack encoding for the Fluentd forward protocol.
+// Only the types that can appear in records are supported, everything else is encoded via fmt.Sprint.
+
+func msgpackAppend(b []byte, v any) []byte {
+	switch v := v.(type) {
+	case nil:
+		return append(b, 0xc0)
+	case bool:
+		if v {
+			return append(b, 0xc3)
+		}
+		return append(b, 0xc2)
+	case int:
+		return msgpackAppendInt(b, int64(v))
+	case int8:
+		return msgpackAppendInt(b, int64(v))
+	case int16:
+		return msgpackAppendInt(b, int64(v))
+	case int32:
+		return msgpackAppendInt(b, int64(v))
+	case int64:
+		return msgpackAppendInt(b, v)
+	case uint:
+		return msgpackAppendUint(b, uint64(v))
+	case uint8:
+		return msgpackAppendUint(b, uint64(v))
+	case uint16:
+		return msgpackAppendUint(b, uint64(v))
+	case uint32:
+		return msgpackAppendUint(b, uint64(v))
+	case uint64:
+		return msgpackAppendUint(b, v)
+	case float32:
+		return binary.BigEndian.AppendUint32(append(b, 0xca), math.Float32bits(v))
+	case float64:
+		return binary.BigEndian.AppendUint64(append(b, 0xcb), math.Float64bits(v))
+	case string:
+		return msgpackAppendString(b, v)
+	case []byte:
+		return msgpackAppendBinary(b, v)
+	case time.Time:
+		return msgpackAppendEventTime(b, v)
+	case []any:
+		b = msgpackAppendArrayHeader(b, len(v))
+		for _, item := range v {
+			b = msgpackAppend(b, item)
+		}
+		return b
+	case []string:
+		b = msgpackAppendArrayHeader(b, len(v))
+		for _, item := range v {
+			b = msgpackAppendString(b, item)
+		}
+		return b
+	case map[string]any:
+		// sorted keys keep the output deterministic
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b = msgpackAppendMapHeader(b, len(v))
+		for _, key := range keys {
+			b = msgpackAppendString(b, key)
+			b = msgpackAppend(b, v[key])
+		}
+		return b
+	case map[string]string:
+		m := make(map[string]any, len(v))
+		for key, value := range v {
+			m[key] = value
+		}
+		return msgpackAppend(b, m)
+	case error:
+		return msgpackAppendString(b, v.Error())
+	case fmt.Stringer:
+		return msgpackAppendString(b, v.String())
+	default:
+		return msgpackAppendString(b, fmt.Sprint(v))
+	}
+}
+
+func msgpackAppendInt(b []byte, v int64) []byte {
+	switch {
+	case v >= 0:
+		return msgpackAppendUint(b, uint64(v))
+	case v >= -32:
+		return append(b, byte(v))
+	case v >= math.MinInt8:
+		return append(b, 0xd0, byte(v))
+	case v >= math.MinInt16:
+		return binary.BigEndian.AppendUint16(append(b, 0xd1), uint16(v))
+	case v >= math.MinInt32:
+		return binary.BigEndian.AppendUint32(append(b, 0xd2), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xd3), uint64(v))
+}
+
+func msgpackAppendUint(b []byte, v uint64) []byte {
+	switch {
+	case v <= 0x7f:
+		return append(b, byte(v))
+	case v <= math.MaxUint8:
+		return append(b, 0xcc, byte(v))
+	case v <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xcd), uint16(v))
+	case v <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32(append(b, 0xce), uint32(v))
+	}
+	return binary.BigEndian.AppendUint64(append(b, 0xcf), v)
+}
+
+func msgpackAppendString(b []byte, s string) []byte {
+	switch n := len(s); {
+	case n <= 31:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xda), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xdb), uint32(n))
+	}
+	return append(b, s...)
+}
+
+func msgpackAppendBinary(b []byte, data []byte) []byte {
+	switch n := len(data); {
+	case n <= math.MaxUint8:
+		b = append(b, 0xc4, byte(n))
+	case n <= math.MaxUint16:
+		b = binary.BigEndian.AppendUint16(append(b, 0xc5), uint16(n))
+	default:
+		b = binary.BigEndian.AppendUint32(append(b, 0xc6), uint32(n))
+	}
+	return append(b, data...)
+}
+
+func msgpackAppendArrayHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x90|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xdc), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, 0xdd), uint32(n))
+}
+
+func msgpackAppendMapHeader(b []byte, n int) []byte {
+	switch {
+	case n <= 15:
+		return append(b, 0x80|byte(n))
+	case n <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16(append(b, 0xde), uint16(n))
+	}
+	return binary.BigEndian.AppendUint32(append(b, 0xdf), uint32(n))
+}
+
+// Fluentd EventTime: ext type 0 holding seconds and nanoseconds
+func msgpackAppendEventTime(b []byte, t time.Time) []byte {
+	b = append(b, 0xd7, 0x00)
+	b = binary.BigEndian.AppendUint32(b, uint32(t.Unix()))
+	return binary.BigEndian.AppendUint32(b, uint32(t.Nanosecond()))
+}
+
+// Largest string, binary, array or map accepted by msgpackDecode, far more than an ack carries.
+// Keeps a misbehaving peer from making the writer allocate gigabytes.
+const msgpackMaxLength = 1 << 20
+
+// msgpackDecode reads a single value. Maps are decoded to map[string]any, ext types to []byte.
+func msgpackDecode(r io.ByteReader) (any, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case c <= 0x7f:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return msgpackDecodeMap(r, int(c&0x0f))
+	case c&0xf0 == 0x90:
+		return msgpackDecodeArray(r, int(c&0x0f))
+	case c&0xe0 == 0xa0:
+		data, err := msgpackReadBytes(r, int(c&0x1f))
+		return string(data), err
+	}
+
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2:
+		return false, nil
+	case 0xc3:
+		return true, nil
+	case 0xc4, 0xc5, 0xc6:
+		n, err := msgpackReadLength(r, c-0xc4)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackReadBytes(r, n)
+	case 0xca:
+		data, err := msgpackReadBytes(r, 4)
+		if err != nil {
+			return nil, err
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data))), nil
+	case 0xcb:
+		data, err := msgpackReadBytes(r, 8)
+		if err != nil {
+			return nil, err
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(data)), nil
+	case 0xcc, 0xcd, 0xce, 0xcf:
+		data, err := msgpackReadBytes(r, 1<<(c-0xcc))
+		if err != nil {
+			return nil, err
+		}
+		return int64(msgpackUint(data)), nil
+	case 0xd0, 0xd1, 0xd2, 0xd3:
+		size := 1 << (c - 0xd0)
+		data, err := msgpackReadBytes(r, size)
+		if err != nil {
+			return nil, err
+		}
+		// sign extend
+		shift := 64 - 8*size
+		return int64(msgpackUint(data)<<shift) >> shift, nil
+	case 0xd4, 0xd5, 0xd6, 0xd7, 0xd8:
+		if _, err := r.ReadByte(); err != nil {
+			return nil, err
+		}
+		return msgpackReadBytes(r, 1<<(c-0xd4))
+	case 0xd9, 0xda, 0xdb:
+		n, err := msgpackReadLength(r, c-0xd9)
+		if err != nil {
+			return nil, err
+		}
+		data, err := msgpackReadBytes(r, n)
+		return string(data), err
+	case 0xdc, 0xdd:
+		n, err := msgpackReadLength(r, c-0xdc+1)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackDecodeArray(r, n)
+	case 0xde, 0xdf:
+		n, err := msgpackReadLength(r, c-0xde+1)
+		if err != nil {
+			return nil, err
+		}
+		return msgpackDecodeMap(r, n)
+	}
+	return nil, fmt.Errorf("msgpack: unsupported type 0x%x", c)
+}
+
+func msgpackDecodeArray(r io.ByteReader, n int) ([]any, error) {
+	if err := msgpackCheckLength(n); err != nil {
+		return nil, err
+	}
+	array := make([]any, n)
+	for i := range array {
+		value, err := msgpackDecode(r)
+		if err != nil {
+			return nil, err
+		}
+		array[i] = value
+	}
+	return array, nil
+}
+
+func msgpackDecodeMap(r io.ByteReader, n int) (map[string]any, error) {
+	if err := msgpackCheckLength(n); err != nil {
+		return nil, err
+	}
+	m := make(map[string]any, n)
+	for range n {
+		key, err := msgpackDecode(r)
+		if err != nil {
+			return nil, err
+		}
+		value, err := msgpackDecode(r)
+		if err != nil {
+			return nil, err
+		}
+		m[fmt.Sprint(key)] = value
+	}
+	return m, nil
+}
+
+// msgpackReadLength reads a 1, 2 or 4 byte length for sizeClass 0, 1 or 2
+func msgpackReadLength(r io.ByteReader, sizeClass byte) (int, error) {
+	data, err := msgpackReadBytes(r, 1<<sizeClass)
+	return int(msgpackUint(data)), err
+}
+
+func msgpackReadBytes(r io.ByteReader, n int) ([]byte, error) {
+	if err := msgpackCheckLength(n); err != nil {
+		return nil, err
+	}
+	data := make([]byte, n)
+	for i := range data {
+		c, err := r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		data[i] = c
+	}
+	return data, nil
+}
+
+func msgpackCheckLength(n int) error {
+	if n < 0 {
+		return errors.New("msgpack: invalid length")
+	}
+	if n > msgpackMaxLength {
+		return fmt.Errorf("msgpack: length %d exceeds the limit of %d", n, msgpackMaxLength)
+	}
+	return nil
+}
+
+func msgpackUint(data []byte) uint64 {
+	var v uint64
+	for _, c := range data {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
@@ -0,0 +1,95 @@
+package llog
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMsgpack(t *testing.T) {
+	values := []struct {
+		in  any
+		out any
+	}{
+		{nil, nil},
+		{true, true},
+		{false, false},
+		{5, int64(5)},
+		{-5, int64(-5)},
+		{int8(-100), int64(-100)},
+		{int16(-1000), int64(-1000)},
+		{int32(-100000), int64(-100000)},
+		{int64(math.MinInt64), int64(math.MinInt64)},
+		{uint8(200), int64(200)},
+		{uint16(60000), int64(60000)},
+		{uint32(4000000000), int64(4000000000)},
+		{uint(1 << 40), int64(1 << 40)},
+		{float32(1.5), float64(1.5)},
+		{2.25, 2.25},
+		{"short", "short"},
+		{strings.Repeat("a", 40), strings.Repeat("a", 40)},
+		{strings.Repeat("b", 300), strings.Repeat("b", 300)},
+		{strings.Repeat("c", 70000), strings.Repeat("c", 70000)},
+		{[]byte{1, 2, 3}, []byte{1, 2, 3}},
+		{bytes.Repeat([]byte{7}, 300), bytes.Repeat([]byte{7}, 300)},
+		{[]string{"a", "b"}, []any{"a", "b"}},
+		{make([]any, 20), make([]any, 20)},
+		{map[string]string{"k": "v"}, map[string]any{"k": "v"}},
+		{map[string]any{"nested": []any{int64(1), "x"}}, map[string]any{"nested": []any{int64(1), "x"}}},
+		{errors.New("failed"), "failed"},
+		{time.Second, "1s"},
+		{struct{ A int }{1}, "{1}"},
+	}
+
+	for _, value := range values {
+		encoded := msgpackAppend(nil, value.in)
+		decoded, err := msgpackDecode(bytes.NewReader(encoded))
+		if err != nil {
+			t.Errorf("%T: %v", value.in, err)
+			continue
+		}
+		if !reflect.DeepEqual(decoded, value.out) {
+			t.Errorf("%T: expected %v got %v", value.in, value.out, decoded)
+		}
+	}
+
+	// Larger maps use the map16 header
+	large := make(map[string]any)
+	for i := range 20 {
+		large[strings.Repeat("k", i+1)] = int64(i)
+	}
+	decoded, err := msgpackDecode(bytes.NewReader(msgpackAppend(nil, large)))
+	if err != nil || !reflect.DeepEqual(decoded, large) {
+		t.Errorf("large map roundtrip failed: %v", err)
+	}
+
+	// EventTime is an ext type holding seconds and nanoseconds
+	now := time.Unix(1700000000, 123)
+	decoded, err = msgpackDecode(bytes.NewReader(msgpackAppend(nil, now)))
+	if err != nil || !bytes.Equal(decoded.([]byte), []byte{0x65, 0x53, 0xf1, 0x00, 0, 0, 0, 123}) {
+		t.Errorf("unexpected event time %v %v", decoded, err)
+	}
+
+	if _, err := msgpackDecode(bytes.NewReader([]byte{0xc1})); err == nil {
+		t.Error("expected error for unsupported type")
+	}
+	if _, err := msgpackDecode(bytes.NewReader([]byte{0xa5, 'a'})); err == nil {
+		t.Error("expected error for truncated input")
+	}
+
+	// Lengths beyond the limit are rejected before allocating
+	for _, header := range [][]byte{
+		{0xc6, 0xff, 0xff, 0xff, 0xff},
+		{0xdb, 0x80, 0x00, 0x00, 0x00},
+		{0xdd, 0xff, 0xff, 0xff, 0xff},
+		{0xdf, 0x00, 0x20, 0x00, 0x00},
+	} {
+		if _, err := msgpackDecode(bytes.NewReader(header)); err == nil || !strings.Contains(err.Error(), "exceeds the limit") {
+			t.Errorf("% x: unexpected error %v", header, err)
+		}
+	}
+}
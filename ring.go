@@ -0,0 +1,36 @@
+package llog
+
+import "sync"
+
+// RingBuffer is a Sink keeping the most recent records in memory, e.g. to dump them on demand
+type RingBuffer struct {
+	mu      sync.Mutex
+	records []Record
+	next    int // index overwritten by the next record once the buffer is full
+}
+
+// Keep the last size records
+func NewRingBuffer(size int) *RingBuffer {
+	return &RingBuffer{records: make([]Record, 0, max(size, 1))}
+}
+
+func (b *RingBuffer) Write(r Record) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(b.records) < cap(b.records) {
+		b.records = append(b.records, r)
+		return nil
+	}
+	b.records[b.next] = r
+	b.next = (b.next + 1) % len(b.records)
+	return nil
+}
+
+// Return the buffered records, oldest first
+func (b *RingBuffer) Records() []Record {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	records := make([]Record, 0, len(b.records))
+	records = append(records, b.records[b.next:]...)
+	return append(records, b.records[:b.next]...)
+}
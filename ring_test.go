@@ -0,0 +1,40 @@
+package llog
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestRingBuffer(t *testing.T) {
+	ring := NewRingBuffer(3)
+	messages := func() string {
+		var result string
+		for _, record := range ring.Records() {
+			result += record.Message
+		}
+		return result
+	}
+
+	if len(ring.Records()) != 0 {
+		t.Error("expected empty buffer")
+	}
+	ring.Write(textRecord("a"))
+	ring.Write(textRecord("b"))
+	if messages() != "ab" {
+		t.Errorf("unexpected records %q", messages())
+	}
+	for _, message := range []string{"c", "d", "e", "f", "g"} {
+		ring.Write(textRecord(message))
+	}
+	if messages() != "efg" {
+		t.Errorf("expected the last records oldest first, got %q", messages())
+	}
+
+	ring = NewRingBuffer(0)
+	for i := range 3 {
+		ring.Write(textRecord(fmt.Sprint(i)))
+	}
+	if messages() != "2" {
+		t.Errorf("unexpected records %q", messages())
+	}
+}
@@ -0,0 +1,352 @@
+package llog
+
+import (
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var s3MD5ETag = regexp.MustCompile(`^[0-9a-fA-F]{32}$`)
+
+const (
+	s3DefaultRegion        = "us-east-1"
+	s3DefaultKeyTemplate   = "{service}/{date}/{host}/{file}"
+	s3DefaultRetryInterval = time.Minute
+	s3Algorithm            = "AWS4-HMAC-SHA256"
+)
+
+type S3Options struct {
+	// Endpoint of the S3 compatible storage, e.g. "https://s3.eu-central-1.amazonaws.com" or "http://localhost:9000".
+	// Buckets are addressed path style.
+	Endpoint string
+	// Region used for signing, defaults to "us-east-1"
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// Optional session token of temporary credentials
+	SessionToken string
+	// Object key of an archived file. Supports {service}, {host}, {date} (2006-01-02), {year}, {month}, {day}
+	// and {file}, with the date taken from the modification time of the file.
+	// Defaults to "{service}/{date}/{host}/{file}".
+	KeyTemplate string
+	// Value of {service}, defaults to the executable name
+	Service string
+	// Keep the local file after a successful upload
+	KeepLocal bool
+	// Also compare the returned ETag with the MD5 of the file. The storage verifies the upload with
+	// Content-MD5 anyway, and ETags of SSE-KMS encrypted or multipart objects are no MD5.
+	// ETags that are no 32 digit hex string are never compared.
+	VerifyETag bool
+	// Glob of rotated log files picked up automatically, e.g. "/var/log/app/*.log.*". Empty disables scanning.
+	Pattern string
+	// Interval of scanning Pattern and retrying failed uploads, defaults to 1m
+	RetryInterval time.Duration
+	// Called when an upload fails, defaults to printing to Stderr. The upload is retried later.
+	OnError func(path string, err error)
+	// HTTP client used for all requests, defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// S3Archiver uploads completed log files to S3 compatible object storage
+type S3Archiver struct {
+	opts     S3Options
+	endpoint *url.URL
+	host     string
+
+	mu        sync.Mutex
+	pending   map[string]bool // failed uploads waiting for a retry
+	uploaded  map[string]bool // files kept locally that must not be uploaded again
+	uploading map[string]bool // uploads in progress
+
+	done      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+}
+
+func NewS3Archiver(opts S3Options) (*S3Archiver, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("s3: bucket is required")
+	}
+	if opts.AccessKey == "" || opts.SecretKey == "" {
+		return nil, errors.New("s3: credentials are required")
+	}
+	endpoint, err := url.Parse(opts.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme == "" || endpoint.Host == "" {
+		return nil, errors.New("s3: invalid endpoint " + opts.Endpoint)
+	}
+	if opts.Pattern != "" {
+		if _, err := filepath.Glob(opts.Pattern); err != nil {
+			return nil, err
+		}
+	}
+	if opts.Region == "" {
+		opts.Region = s3DefaultRegion
+	}
+	if opts.KeyTemplate == "" {
+		opts.KeyTemplate = s3DefaultKeyTemplate
+	}
+	if opts.Service == "" {
+		executable, _ := os.Executable()
+		opts.Service = filepath.Base(executable)
+	}
+	if opts.RetryInterval <= 0 {
+		opts.RetryInterval = s3DefaultRetryInterval
+	}
+	if opts.OnError == nil {
+		opts.OnError = func(path string, err error) {
+			fmt.Fprintf(os.Stderr, "llog: archiving %s failed: %v\n", path, err)
+		}
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	a := &S3Archiver{
+		opts:      opts,
+		endpoint:  endpoint,
+		pending:   map[string]bool{},
+		uploaded:  map[string]bool{},
+		uploading: map[string]bool{},
+		done:      make(chan struct{}),
+	}
+	a.host, _ = os.Hostname()
+
+	a.wg.Add(1)
+	go a.run()
+	return a, nil
+}
+
+// Upload a completed log file. On failure it is retried every RetryInterval.
+// Files already being uploaded by another call are skipped.
+func (a *S3Archiver) Archive(path string) error {
+	a.mu.Lock()
+	if a.uploading[path] {
+		a.mu.Unlock()
+		return nil
+	}
+	a.uploading[path] = true
+	a.mu.Unlock()
+
+	err := a.upload(path)
+
+	a.mu.Lock()
+	delete(a.uploading, path)
+	if err != nil {
+		a.pending[path] = true
+	} else {
+		delete(a.pending, path)
+		if a.opts.KeepLocal {
+			a.uploaded[path] = true
+		}
+	}
+	a.mu.Unlock()
+
+	if err != nil {
+		a.opts.OnError(path, err)
+	}
+	return err
+}
+
+// Retry failed uploads and archive all files matching Pattern now
+func (a *S3Archiver) Sync() error {
+	a.mu.Lock()
+	paths := make([]string, 0, len(a.pending))
+	for path := range a.pending {
+		paths = append(paths, path)
+	}
+	a.mu.Unlock()
+
+	if a.opts.Pattern != "" {
+		matches, _ := filepath.Glob(a.opts.Pattern)
+		paths = append(paths, matches...)
+	}
+	sort.Strings(paths)
+
+	var errs []error
+	for i, path := range paths {
+		if i > 0 && paths[i-1] == path {
+			continue
+		}
+		a.mu.Lock()
+		done := a.uploaded[path]
+		a.mu.Unlock()
+		if done {
+			continue
+		}
+		if err := a.Archive(path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Stop the background scanning and retrying
+func (a *S3Archiver) Close() error {
+	a.closeOnce.Do(func() {
+		close(a.done)
+		a.wg.Wait()
+	})
+	return nil
+}
+
+func (a *S3Archiver) run() {
+	defer a.wg.Done()
+	ticker := time.NewTicker(a.opts.RetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-a.done:
+			return
+		case <-ticker.C:
+			a.Sync()
+		}
+	}
+}
+
+// upload puts the file and removes it locally unless it is kept
+func (a *S3Archiver) upload(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			// archived or removed in the meantime
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	md5Hash := md5.New()
+	sha256Hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), file); err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	md5Sum := md5Hash.Sum(nil)
+
+	objectURL := *a.endpoint
+	objectURL.Path = strings.TrimSuffix(objectURL.Path, "/") + "/" + a.opts.Bucket + "/" + a.key(path, info.ModTime())
+
+	request, err := http.NewRequest(http.MethodPut, objectURL.String(), file)
+	if err != nil {
+		return err
+	}
+	request.ContentLength = info.Size()
+	request.Header.Set("Content-Type", "text/plain")
+	request.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(md5Sum))
+	a.sign(request, hex.EncodeToString(sha256Hash.Sum(nil)), time.Now())
+
+	response, err := a.opts.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("s3: upload failed with status %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	// The ETag of an unencrypted single part upload is the MD5 of the object
+	etag := strings.Trim(response.Header.Get("ETag"), `"`)
+	if a.opts.VerifyETag && s3MD5ETag.MatchString(etag) && etag != hex.EncodeToString(md5Sum) {
+		return fmt.Errorf("s3: checksum mismatch, uploaded %x but stored %s", md5Sum, etag)
+	}
+
+	if a.opts.KeepLocal {
+		return nil
+	}
+	return os.Remove(path)
+}
+
+func (a *S3Archiver) key(path string, modified time.Time) string {
+	modified = modified.UTC()
+	return strings.NewReplacer(
+		"{service}", a.opts.Service,
+		"{host}", a.host,
+		"{date}", modified.Format("2006-01-02"),
+		"{year}", modified.Format("2006"),
+		"{month}", modified.Format("01"),
+		"{day}", modified.Format("02"),
+		"{file}", filepath.Base(path),
+	).Replace(a.opts.KeyTemplate)
+}
+
+// sign adds an AWS Signature Version 4 Authorization header
+func (a *S3Archiver) sign(request *http.Request, payloadHash string, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	request.Header.Set("X-Amz-Date", amzDate)
+	request.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	if a.opts.SessionToken != "" {
+		request.Header.Set("X-Amz-Security-Token", a.opts.SessionToken)
+	}
+
+	headers := map[string]string{"host": request.URL.Host}
+	for name, values := range request.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		request.Method,
+		request.URL.EscapedPath(),
+		request.URL.Query().Encode(),
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := date + "/" + a.opts.Region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := s3Algorithm + "\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+a.opts.SecretKey), date)
+	key = hmacSHA256(key, a.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	request.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s3Algorithm, a.opts.AccessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
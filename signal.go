@@ -0,0 +1,129 @@
+//go:build unix
+
+package llog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+type SignalOptions struct {
+	// Called on SIGHUP before the sinks are reopened, e.g. to read the configuration again.
+	// Returned errors are logged.
+	Reload func() error
+	// Recent records dumped on SIGUSR2. Nil registers a RingBuffer of the last 100 records
+	// as sink while the handlers are installed.
+	Ring *RingBuffer
+	// Destination of the SIGUSR2 dump, defaults to Stderr
+	Output io.Writer
+}
+
+type signalHandler struct {
+	opts SignalOptions
+	// Level restored when SIGUSR1 turns Debug off again
+	previous Level
+}
+
+// Install signal handlers for daemons without an admin endpoint:
+// SIGUSR1 toggles the Debug level on and off, SIGUSR2 dumps the configuration and the recent records,
+// SIGHUP calls opts.Reload and reopens the file sinks. The returned function uninstalls the handlers,
+// restoring the default behavior of the signals, and waits for a running action to finish.
+func HandleSignals(opts SignalOptions) (stop func()) {
+	var ownRing bool
+	if opts.Ring == nil {
+		opts.Ring = NewRingBuffer(100)
+		AddSink(opts.Ring)
+		ownRing = true
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stderr
+	}
+
+	h := &signalHandler{opts: opts, previous: LevelInfo}
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2, syscall.SIGHUP)
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case sig := <-signals:
+				h.handle(sig)
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(signals)
+			close(done)
+			wg.Wait()
+			if ownRing {
+				RemoveSink(opts.Ring)
+			}
+		})
+	}
+}
+
+func (h *signalHandler) handle(sig os.Signal) {
+	switch sig {
+	case syscall.SIGUSR1:
+		h.toggleDebug()
+	case syscall.SIGUSR2:
+		h.dump()
+	case syscall.SIGHUP:
+		h.reload()
+	}
+}
+
+func (h *signalHandler) toggleDebug() {
+	level := GetLogLevel()
+	if levelDefinition(level).Severity > levelDefinition(LevelDebug).Severity {
+		h.previous = level
+		SetLogLevel(LevelDebug)
+	} else {
+		// Debug or more verbose was on, also if it was not set by a signal
+		SetLogLevel(h.previous)
+	}
+	Notice("Log level changed to %s by signal", GetLogLevel())
+}
+
+func (h *signalHandler) dump() {
+	w := h.opts.Output
+	fmt.Fprintf(w, "llog: level=%s vmodule=%s trace_span_events=%t\n",
+		GetLogLevel(), textValue(VModule()), traceSpanEvents.Load())
+	sinksMu.RLock()
+	for _, s := range sinks {
+		fmt.Fprintf(w, "llog: sink %T\n", s)
+	}
+	sinksMu.RUnlock()
+
+	records := h.opts.Ring.Records()
+	fmt.Fprintf(w, "llog: last %d records\n", len(records))
+	for _, record := range records {
+		if line, err := TextEncoder(record); err == nil {
+			fmt.Fprintf(w, "%s\n", line)
+		}
+	}
+}
+
+func (h *signalHandler) reload() {
+	if h.opts.Reload != nil {
+		if err := h.opts.Reload(); err != nil {
+			Error("Reloading configuration failed: %v", err)
+		}
+	}
+	if err := ReopenSinks(); err != nil {
+		Error("Reopening sinks failed: %v", err)
+	}
+	Notice("Configuration reloaded by signal")
+}
@@ -0,0 +1,16 @@
+//go:build !unix
+
+package llog
+
+import "io"
+
+type SignalOptions struct {
+	Reload func() error
+	Ring   *RingBuffer
+	Output io.Writer
+}
+
+// SIGUSR1, SIGUSR2 and SIGHUP do not exist on this platform, the handlers are not installed
+func HandleSignals(opts SignalOptions) (stop func()) {
+	return func() {}
+}
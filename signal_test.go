@@ -0,0 +1,87 @@
+//go:build unix
+
+package llog
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestHandleSignals(t *testing.T) {
+	SetLogLevel(LevelWarn)
+	defer SetLogLevel(LevelDebug)
+	stdout = &syncBuffer{}
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	reloads := make(chan struct{}, 1)
+	var dump syncBuffer
+	stop := HandleSignals(SignalOptions{
+		Reload: func() error {
+			reloads <- struct{}{}
+			return errors.New("broken config")
+		},
+		Output: &dump,
+	})
+	defer stop()
+
+	raise := func(sig syscall.Signal, done func() bool) {
+		t.Helper()
+		if err := syscall.Kill(os.Getpid(), sig); err != nil {
+			t.Fatal(err)
+		}
+		deadline := time.Now().Add(2 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("%v not handled", sig)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	raise(syscall.SIGUSR1, func() bool { return GetLogLevel() == LevelDebug })
+	Info("recent record")
+	raise(syscall.SIGUSR1, func() bool { return GetLogLevel() == LevelWarn })
+
+	raise(syscall.SIGUSR2, func() bool { return strings.Contains(dump.String(), "recent record") })
+	output := dump.String()
+	for _, expected := range []string{"llog: level=Warn vmodule=\"\"", "llog: sink *llog.recordSink", "llog: sink *llog.RingBuffer", "INFO signal_test.go"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("dump without %q: %q", expected, output)
+		}
+	}
+
+	raise(syscall.SIGHUP, func() bool { return len(reloads) == 1 })
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(recordMessages(sink), "Reloading configuration failed: broken config") && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if !strings.Contains(recordMessages(sink), "Reloading configuration failed: broken config") {
+		t.Errorf("reload error not logged: %s", recordMessages(sink))
+	}
+
+	// Stopping removes the own ring buffer
+	stop()
+	stop()
+	sinksMu.RLock()
+	for _, s := range sinks {
+		if _, ok := s.(*RingBuffer); ok {
+			t.Error("ring buffer still registered")
+		}
+	}
+	sinksMu.RUnlock()
+}
+
+func recordMessages(sink *recordSink) string {
+	var messages []string
+	for _, record := range sink.snapshot() {
+		messages = append(messages, record.Message)
+	}
+	return strings.Join(messages, "\n")
+}
@@ -0,0 +1,226 @@
+package llog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Record is a single log entry as it is handed to the registered sinks.
+type Record struct {
+	Time    time.Time
+	Level   Level
+	Message string
+	File    string
+	Line    int
+	// Name of the calling function if enabled with SetCaller
+	Function string
+	// Stack trace if the level captures one
+	Stack  StackTrace
+	Fields map[string]any
+}
+
+// Sink receives every record that passes the level filter, next to the stdout output.
+// Sinks holding connections or files should also implement io.Closer.
+type Sink interface {
+	Write(r Record) error
+}
+
+var sinksMu sync.RWMutex
+var sinks []Sink
+
+var sinkErrorHandler = printSinkError
+
+// Register a sink that receives all records logged from now on
+func AddSink(s Sink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	sinks = append(sinks, s)
+}
+
+// Unregister a sink. The sink is not closed.
+func RemoveSink(s Sink) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	for i, registered := range sinks {
+		if registered == s {
+			sinks = append(sinks[:i:i], sinks[i+1:]...)
+			return
+		}
+	}
+}
+
+// Close and unregister all sinks. Errors of the individual sinks are joined.
+func CloseSinks() error {
+	sinksMu.Lock()
+	closing := sinks
+	sinks = nil
+	sinksMu.Unlock()
+
+	var errs []error
+	for _, s := range closing {
+		if closer, ok := s.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Flush the buffered records of all sinks implementing Flush() error, e.g. the Kafka or Splunk writers.
+// Errors of the individual sinks are joined.
+func FlushSinks() error {
+	sinksMu.RLock()
+	registered := sinks
+	sinksMu.RUnlock()
+
+	var errs []error
+	for _, s := range registered {
+		if flusher, ok := s.(interface{ Flush() error }); ok {
+			if err := flusher.Flush(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Reopen the files of all sinks implementing Reopen() error, e.g. after they were rotated.
+// Errors of the individual sinks are joined.
+func ReopenSinks() error {
+	sinksMu.RLock()
+	registered := sinks
+	sinksMu.RUnlock()
+
+	var errs []error
+	for _, s := range registered {
+		if reopener, ok := s.(interface{ Reopen() error }); ok {
+			if err := reopener.Reopen(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Set the function called when a sink fails to write a record.
+// Defaults to printing the error to Stderr, nil restores the default.
+func SetSinkErrorHandler(handler func(s Sink, err error)) {
+	sinksMu.Lock()
+	defer sinksMu.Unlock()
+	if handler == nil {
+		handler = printSinkError
+	}
+	sinkErrorHandler = handler
+}
+
+// dispatch builds a record and hands it to all sinks.
+// It must be called directly from the exported log function so the caller lookup matches.
+func dispatch(level Level, fields map[string]any, msg any, a ...any) {
+	dispatchSkip(level, fields, 2, msg, a...)
+}
+
+// dispatchSkip hands a record with the location skip frames above its caller to all sinks
+func dispatchSkip(level Level, fields map[string]any, skip int, msg any, a ...any) {
+	dispatchRecord(level, fields, skip+1, false, msg, a...)
+}
+
+// dispatchRecord is dispatchSkip also capturing a stack trace if stack is set
+func dispatchRecord(level Level, fields map[string]any, skip int, stack bool, msg any, a ...any) {
+	if !hasSinks() {
+		return
+	}
+	var trace StackTrace
+	if stack || levelDefinition(level).Stack {
+		trace = captureStack(skip + 1)
+	}
+	dispatchTrace(level, fields, skip+1, trace, msg, a...)
+}
+
+// dispatchTrace is dispatchSkip with the given stack trace, e.g. the one carried by an error
+func dispatchTrace(level Level, fields map[string]any, skip int, trace StackTrace, msg any, a ...any) {
+	// Sinks and the error handler run without the lock, so they may log or unregister sinks themselves
+	sinksMu.RLock()
+	registered, handler := sinks, sinkErrorHandler
+	sinksMu.RUnlock()
+	if len(registered) == 0 {
+		return
+	}
+
+	file, line, function := callerLoc(skip + 1)
+	record := Record{
+		Time:     time.Now(),
+		Level:    level,
+		Message:  formatMessage(msg, a...),
+		File:     file,
+		Line:     line,
+		Function: function,
+		Stack:    trace,
+		Fields:   fields,
+	}
+	for _, s := range registered {
+		if err := s.Write(record); err != nil {
+			handler(s, err)
+		}
+	}
+}
+
+func hasSinks() bool {
+	sinksMu.RLock()
+	defer sinksMu.RUnlock()
+	return len(sinks) > 0
+}
+
+// reportSinkError hands errors of sinks working in the background to the error handler
+func reportSinkError(s Sink, err error) {
+	sinksMu.RLock()
+	handler := sinkErrorHandler
+	sinksMu.RUnlock()
+	handler(s, err)
+}
+
+func printSinkError(s Sink, err error) {
+	fmt.Fprintf(os.Stderr, "llog: sink %T failed: %v\n", s, err)
+}
+
+// recordMap flattens a record into its fields plus level, message and caller.
+// static fields are added first and can be overwritten by the record.
+func recordMap(r Record, static map[string]any) map[string]any {
+	fields := make(map[string]any, len(static)+len(r.Fields)+4)
+	for key, value := range static {
+		fields[key] = value
+	}
+	for key, value := range r.Fields {
+		// errors without their own encoding would be encoded as empty objects
+		if err, ok := value.(error); ok {
+			if _, marshaler := value.(json.Marshaler); !marshaler {
+				value = err.Error()
+			}
+		}
+		fields[key] = value
+	}
+	fields["level"] = levelName(r.Level)
+	fields["message"] = r.Message
+	if r.File != "" {
+		fields["file"] = r.File
+		fields["line"] = r.Line
+	}
+	if r.Function != "" {
+		fields["function"] = r.Function
+	}
+	if len(r.Stack) > 0 {
+		fields["stack"] = r.Stack
+	}
+	return fields
+}
+
+// epochSeconds formats t as unix seconds with millisecond precision, as used by GELF and Splunk
+func epochSeconds(t time.Time) json.Number {
+	return json.Number(strconv.FormatFloat(float64(t.UnixMilli())/1000, 'f', 3, 64))
+}
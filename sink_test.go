@@ -0,0 +1,143 @@
+package llog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Sink collecting all records for inspection
+type recordSink struct {
+	mu      sync.Mutex
+	records []Record
+	err     error
+	closed  bool
+}
+
+func (s *recordSink) Write(r Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, r)
+	return s.err
+}
+
+// Copy of the records for sinks written from other goroutines
+func (s *recordSink) snapshot() []Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]Record(nil), s.records...)
+}
+
+func (s *recordSink) Close() error {
+	s.closed = true
+	return s.err
+}
+
+// Buffer safe for the writes of other goroutines
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestSinks(t *testing.T) {
+	SetLogLevel(LevelInfo)
+	defer SetLogLevel(LevelDebug)
+	stdout = io.Discard
+	defer func() { stdout = os.Stdout }()
+
+	sink := &recordSink{}
+	AddSink(sink)
+
+	Debug("filtered")
+	Info("Hello %s", "World")
+	ErrNil(errors.New("broken"))
+
+	if len(sink.records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(sink.records))
+	}
+	record := sink.records[0]
+	if record.Level != LevelInfo || record.Message != "Hello World" {
+		t.Errorf("unexpected record %+v", record)
+	}
+	if record.File != "sink_test.go" || record.Line == 0 {
+		t.Errorf("unexpected caller %s:%d", record.File, record.Line)
+	}
+	if sink.records[1].Level != LevelError || sink.records[1].Message != "broken" {
+		t.Errorf("unexpected record %+v", sink.records[1])
+	}
+
+	// Failing sinks are reported to the error handler
+	var reported error
+	SetSinkErrorHandler(func(s Sink, err error) { reported = err })
+	sink.err = errors.New("sink failed")
+	Warn("Testing")
+	if reported != sink.err {
+		t.Errorf("expected sink error to be reported, got %v", reported)
+	}
+	SetSinkErrorHandler(func(s Sink, err error) {})
+	Warn("Testing")
+
+	RemoveSink(sink)
+	Info("not recorded")
+	if len(sink.records) != 4 {
+		t.Errorf("removed sink still received records")
+	}
+
+	AddSink(sink)
+	if err := CloseSinks(); !errors.Is(err, sink.err) || !sink.closed {
+		t.Errorf("expected sink to be closed with error, got %v", err)
+	}
+	SetSinkErrorHandler(nil)
+}
+
+func TestSinkErrorHandlerRemovesSink(t *testing.T) {
+	stdout = io.Discard
+	defer func() { stdout = os.Stdout }()
+	defer SetSinkErrorHandler(nil)
+
+	failing := &recordSink{err: errors.New("collector gone")}
+	healthy := &recordSink{}
+	AddSink(failing)
+	AddSink(healthy)
+	defer RemoveSink(healthy)
+
+	// The handler may unregister the sink and log without deadlocking
+	SetSinkErrorHandler(func(s Sink, err error) {
+		RemoveSink(s)
+		Warn("dropped sink %T: %v", s, err)
+	})
+	done := make(chan struct{})
+	go func() {
+		Info("first")
+		Info("second")
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("logging deadlocked in the sink error handler")
+	}
+
+	if records := failing.snapshot(); len(records) != 1 {
+		t.Errorf("removed sink received %d records", len(records))
+	}
+	if records := healthy.snapshot(); len(records) != 3 || records[0].Message != "dropped sink *llog.recordSink: collector gone" {
+		t.Errorf("unexpected records %+v", records)
+	}
+}
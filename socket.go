@@ -0,0 +1,349 @@
+package llog
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	socketDefaultMaxSpool   = 64 << 20
+	socketDefaultMinBackoff = 100 * time.Millisecond
+	socketDefaultMaxBackoff = 30 * time.Second
+	socketDefaultTimeout    = 5 * time.Second
+	socketReplayChunk       = 64 << 10
+)
+
+var ErrSpoolFull = errors.New("socket: spool is full, record dropped")
+
+type SocketOptions struct {
+	// Encoding of the records, one per line. Defaults to JSONEncoder.
+	Encoder Encoder
+	// File spooling the records while disconnected. Records left over from a previous run are sent first.
+	// Empty keeps them in memory.
+	SpoolFile string
+	// Maximum spool size in bytes, newer records are dropped when it is full. Defaults to 64 MiB.
+	MaxSpool int64
+	// Reconnect backoff, defaults to 100ms doubling up to 30s
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Dial and write timeout, defaults to 5s
+	Timeout time.Duration
+}
+
+// SocketWriter is a Sink streaming encoded records as lines to a TCP, UDP or Unix socket.
+// While the peer is unreachable records are spooled and replayed in order after reconnecting.
+type SocketWriter struct {
+	network  string
+	addr     string
+	opts     SocketOptions
+	datagram bool
+
+	mu      sync.Mutex
+	conn    net.Conn // nil while disconnected or replaying
+	spool   *spool
+	closed  bool
+	failing bool
+
+	wake chan struct{}
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// Stream to addr on network "tcp", "udp", "unix" or "unixgram" (and their 4/6 variants).
+// The connection is established in the background, records are spooled until then.
+func NewSocketWriter(network string, addr string, opts SocketOptions) (*SocketWriter, error) {
+	datagram := strings.HasPrefix(network, "udp") || network == "unixgram"
+	if !datagram && !strings.HasPrefix(network, "tcp") && network != "unix" {
+		return nil, errors.New("socket: unsupported network " + network)
+	}
+	if opts.Encoder == nil {
+		opts.Encoder = JSONEncoder
+	}
+	if opts.MaxSpool <= 0 {
+		opts.MaxSpool = socketDefaultMaxSpool
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = socketDefaultMinBackoff
+	}
+	if opts.MaxBackoff < opts.MinBackoff {
+		opts.MaxBackoff = max(socketDefaultMaxBackoff, opts.MinBackoff)
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = socketDefaultTimeout
+	}
+
+	spool, err := openSpool(opts.SpoolFile, opts.MaxSpool)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &SocketWriter{
+		network:  network,
+		addr:     addr,
+		opts:     opts,
+		datagram: datagram,
+		spool:    spool,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	w.wg.Add(1)
+	go w.run()
+	return w, nil
+}
+
+func (w *SocketWriter) Write(r Record) error {
+	line, err := w.opts.Encoder(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.closed {
+		return net.ErrClosed
+	}
+	if w.conn != nil {
+		if err := w.writeConn(w.conn, line); err == nil {
+			return nil
+		}
+		w.disconnect(w.conn)
+	}
+	return w.spool.append(line)
+}
+
+// Close the connection. Records still spooled stay in the spool file for the next run.
+func (w *SocketWriter) Close() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+	w.closed = true
+	close(w.done)
+	w.mu.Unlock()
+
+	w.wg.Wait()
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn != nil {
+		w.conn.Close()
+		w.conn = nil
+	}
+	return w.spool.close()
+}
+
+// run keeps reconnecting with exponential backoff while disconnected
+func (w *SocketWriter) run() {
+	defer w.wg.Done()
+	backoff := w.opts.MinBackoff
+
+	for {
+		w.mu.Lock()
+		connected := w.conn != nil
+		w.mu.Unlock()
+
+		wait := w.wake
+		var retry <-chan time.Time
+		if !connected {
+			if err := w.reconnect(); err != nil {
+				// Only report the first failure, not every attempt
+				if !w.failing {
+					reportSinkError(w, err)
+				}
+				w.failing = true
+				retry = time.After(backoff)
+				backoff = min(2*backoff, w.opts.MaxBackoff)
+				wait = nil
+			} else {
+				w.failing = false
+				backoff = w.opts.MinBackoff
+			}
+		}
+
+		select {
+		case <-w.done:
+			return
+		case <-wait:
+		case <-retry:
+		}
+	}
+}
+
+// reconnect dials the peer and replays the spool. The bulk is sent without blocking writers,
+// the remainder under the lock, so no record overtakes a spooled one.
+func (w *SocketWriter) reconnect() error {
+	conn, err := net.DialTimeout(w.network, w.addr, w.opts.Timeout)
+	if err != nil {
+		return err
+	}
+
+	for {
+		w.mu.Lock()
+		chunk, err := w.spool.peek(socketReplayChunk)
+		if err != nil || len(chunk) == 0 {
+			if err == nil {
+				err = w.spool.reset()
+			}
+			if err != nil {
+				w.mu.Unlock()
+				conn.Close()
+				return err
+			}
+			w.conn = conn
+			w.mu.Unlock()
+			if !w.datagram {
+				go w.watch(conn)
+			}
+			return nil
+		}
+		w.mu.Unlock()
+
+		if err := w.writeConn(conn, chunk); err != nil {
+			conn.Close()
+			return err
+		}
+
+		w.mu.Lock()
+		w.spool.advance(len(chunk))
+		w.mu.Unlock()
+	}
+}
+
+// watch detects a stream peer closing the connection before the next write fails
+func (w *SocketWriter) watch(conn net.Conn) {
+	io.Copy(io.Discard, conn)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.conn == conn {
+		w.disconnect(conn)
+	}
+}
+
+// disconnect drops the connection and wakes the reconnect loop. Called with mu held.
+func (w *SocketWriter) disconnect(conn net.Conn) {
+	conn.Close()
+	w.conn = nil
+	select {
+	case w.wake <- struct{}{}:
+	default:
+	}
+}
+
+// writeConn writes complete lines, one datagram per line for packet networks
+func (w *SocketWriter) writeConn(conn net.Conn, lines []byte) error {
+	conn.SetWriteDeadline(time.Now().Add(w.opts.Timeout))
+	if !w.datagram {
+		_, err := conn.Write(lines)
+		return err
+	}
+	for len(lines) > 0 {
+		end := bytes.IndexByte(lines, '\n') + 1
+		if end == 0 {
+			end = len(lines)
+		}
+		if _, err := conn.Write(lines[:end]); err != nil {
+			return err
+		}
+		lines = lines[end:]
+	}
+	return nil
+}
+
+// spool is a bounded queue of newline terminated records in a file or in memory
+type spool struct {
+	file   *os.File // nil keeps the records in memory
+	mem    []byte
+	offset int64 // start of the records not yet replayed
+	size   int64
+	max    int64
+}
+
+func openSpool(path string, max int64) (*spool, error) {
+	s := &spool{max: max}
+	if path == "" {
+		return s, nil
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	s.file = file
+	s.size = info.Size()
+	return s, nil
+}
+
+func (s *spool) append(line []byte) error {
+	if s.size+int64(len(line)) > s.max {
+		return ErrSpoolFull
+	}
+	if s.file == nil {
+		s.mem = append(s.mem, line...)
+	} else if _, err := s.file.WriteAt(line, s.size); err != nil {
+		return err
+	}
+	s.size += int64(len(line))
+	return nil
+}
+
+// peek returns up to max bytes of complete lines, or a single longer line
+func (s *spool) peek(max int) ([]byte, error) {
+	n := min(int64(max), s.size-s.offset)
+	for {
+		chunk, err := s.read(n)
+		if err != nil || len(chunk) == 0 {
+			return chunk, err
+		}
+		if end := bytes.LastIndexByte(chunk, '\n'); end >= 0 {
+			return chunk[:end+1], nil
+		}
+		if n == s.size-s.offset {
+			// unterminated rest of a crashed run
+			return chunk, nil
+		}
+		n = min(2*n, s.size-s.offset)
+	}
+}
+
+func (s *spool) read(n int64) ([]byte, error) {
+	if s.file == nil {
+		return s.mem[s.offset : s.offset+n], nil
+	}
+	chunk := make([]byte, n)
+	_, err := s.file.ReadAt(chunk, s.offset)
+	return chunk, err
+}
+
+func (s *spool) advance(n int) {
+	s.offset += int64(n)
+}
+
+func (s *spool) reset() error {
+	s.offset = 0
+	s.size = 0
+	s.mem = s.mem[:0]
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Truncate(0)
+}
+
+func (s *spool) close() error {
+	if s.file == nil {
+		return nil
+	}
+	return s.file.Close()
+}
@@ -0,0 +1,192 @@
+package llog
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// acceptLines accepts one connection and sends every received line to the returned channel
+func acceptLines(t *testing.T, listener net.Listener) (chan string, chan net.Conn) {
+	t.Helper()
+	lines := make(chan string, 100)
+	conns := make(chan net.Conn, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		conns <- conn
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+	return lines, conns
+}
+
+func nextLine(t *testing.T, lines chan string) string {
+	t.Helper()
+	select {
+	case line := <-lines:
+		return line
+	case <-time.After(3 * time.Second):
+		t.Fatal("no line received")
+		return ""
+	}
+}
+
+func textRecord(message string) Record {
+	return Record{Time: time.Now(), Level: LevelInfo, Message: message}
+}
+
+func TestSocketReconnect(t *testing.T) {
+	dir := t.TempDir()
+	socket := filepath.Join(dir, "collector.sock")
+	spoolFile := filepath.Join(dir, "collector.spool")
+
+	if _, err := NewSocketWriter("ip", socket, SocketOptions{}); err == nil {
+		t.Error("expected error for unsupported network")
+	}
+	if _, err := NewSocketWriter("unix", socket, SocketOptions{SpoolFile: filepath.Join(dir, "missing", "spool")}); err == nil {
+		t.Error("expected error for unusable spool file")
+	}
+
+	// Records from a previous run are replayed first
+	os.WriteFile(spoolFile, []byte("INFO leftover\n"), 0o600)
+
+	writer, err := NewSocketWriter("unix", socket, SocketOptions{
+		Encoder:    func(r Record) ([]byte, error) { return []byte("INFO " + r.Message), nil },
+		SpoolFile:  spoolFile,
+		MinBackoff: 10 * time.Millisecond,
+		MaxBackoff: 20 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	// Nobody is listening yet, records are spooled
+	writer.Write(textRecord("first"))
+	writer.Write(textRecord("second"))
+
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines, conns := acceptLines(t, listener)
+	for _, expected := range []string{"INFO leftover", "INFO first", "INFO second"} {
+		if line := nextLine(t, lines); line != expected {
+			t.Errorf("expected %q got %q", expected, line)
+		}
+	}
+	writer.Write(textRecord("live"))
+	if line := nextLine(t, lines); line != "INFO live" {
+		t.Errorf("expected live record, got %q", line)
+	}
+
+	// The peer drops the connection
+	(<-conns).Close()
+	listener.Close()
+	for deadline := time.Now().Add(3 * time.Second); ; {
+		writer.mu.Lock()
+		connected := writer.conn != nil
+		writer.mu.Unlock()
+		if !connected {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("dropped connection was not detected")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	writer.Write(textRecord("while down"))
+	if data, _ := os.ReadFile(spoolFile); string(data) != "INFO while down\n" {
+		t.Errorf("expected record in spool file, got %q", data)
+	}
+
+	listener, err = net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	lines, _ = acceptLines(t, listener)
+	if line := nextLine(t, lines); line != "INFO while down" {
+		t.Errorf("expected spooled record after reconnect, got %q", line)
+	}
+
+	writer.Close()
+	if err := writer.Write(textRecord("closed")); err == nil {
+		t.Error("expected error writing to closed writer")
+	}
+}
+
+func TestSocketDatagram(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	writer, err := NewSocketWriter("udp", listener.LocalAddr().String(), SocketOptions{Encoder: TextEncoder})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	// Usually written before the background dial finished, every line is sent as its own datagram on replay
+	writer.Write(textRecord("one"))
+	writer.Write(textRecord("two"))
+
+	buf := make([]byte, 1024)
+	for _, expected := range []string{"one", "two"} {
+		listener.SetReadDeadline(time.Now().Add(3 * time.Second))
+		n, _, err := listener.ReadFrom(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line := string(buf[:n]); !strings.HasSuffix(line, " INFO "+expected+"\n") {
+			t.Errorf("unexpected datagram %q", line)
+		}
+	}
+}
+
+func TestSpool(t *testing.T) {
+	s, _ := openSpool("", 10)
+	if err := s.append([]byte("12345\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.append([]byte("67890\n")); !errors.Is(err, ErrSpoolFull) {
+		t.Errorf("expected full spool, got %v", err)
+	}
+
+	// Lines longer than the requested chunk are returned whole
+	s.max = 100
+	s.append([]byte("abc\n"))
+	if chunk, _ := s.peek(3); string(chunk) != "12345\n" {
+		t.Errorf("unexpected chunk %q", chunk)
+	}
+	if chunk, _ := s.peek(8); string(chunk) != "12345\n" {
+		t.Errorf("expected only complete lines, got %q", chunk)
+	}
+	s.advance(6)
+	if chunk, _ := s.peek(100); string(chunk) != "abc\n" {
+		t.Errorf("unexpected chunk %q", chunk)
+	}
+	s.advance(4)
+	if chunk, _ := s.peek(100); len(chunk) != 0 {
+		t.Errorf("expected empty spool, got %q", chunk)
+	}
+
+	// An unterminated rest is returned as is
+	s.reset()
+	s.append([]byte("partial"))
+	if chunk, _ := s.peek(3); string(chunk) != "partial" {
+		t.Errorf("unexpected chunk %q", chunk)
+	}
+}
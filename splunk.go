@@ -0,0 +1,228 @@
+package llog
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	splunkEventPath            = "/services/collector/event"
+	splunkAckPath              = "/services/collector/ack"
+	splunkDefaultBatchSize     = 100
+	splunkDefaultFlushInterval = time.Second
+	splunkDefaultAckTimeout    = 10 * time.Second
+	splunkDefaultMaxBuffer     = 10000
+)
+
+// Interval between polls of the HEC ack endpoint
+var splunkAckPollInterval = 250 * time.Millisecond
+
+type SplunkOptions struct {
+	// HEC token, sent as "Authorization: Splunk <token>"
+	Token string
+	// Event metadata, empty values use the defaults of the token
+	Index      string
+	Source     string
+	SourceType string
+	// Reported host, defaults to os.Hostname()
+	Host string
+	// Indexed fields added to every event
+	Fields map[string]any
+	// Wait for indexer acknowledgement of every batch and resend it if it is not acknowledged
+	UseAck bool
+	// Channel ID sent with every request, required by HEC when acknowledgement is enabled.
+	// Generated if empty and UseAck is set.
+	Channel string
+	// Time to wait for an acknowledgement, defaults to 10s
+	AckTimeout time.Duration
+	// Events per request, defaults to 100
+	BatchSize int
+	// Maximum time an event is buffered before being sent, defaults to 1s
+	FlushInterval time.Duration
+	// Events kept while Splunk is unreachable, the oldest are dropped first. Defaults to 10000.
+	MaxBuffer int
+	// HTTP client used for all requests, defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// SplunkWriter is a Sink posting batched events to a Splunk HTTP Event Collector
+type SplunkWriter struct {
+	eventURL string
+	ackURL   string
+	opts     SplunkOptions
+	batch    *batcher
+}
+
+type splunkEvent struct {
+	Time       json.Number    `json:"time"`
+	Host       string         `json:"host,omitempty"`
+	Source     string         `json:"source,omitempty"`
+	SourceType string         `json:"sourcetype,omitempty"`
+	Index      string         `json:"index,omitempty"`
+	Event      map[string]any `json:"event"`
+	Fields     map[string]any `json:"fields,omitempty"`
+}
+
+type splunkResponse struct {
+	Text  string `json:"text"`
+	Code  int    `json:"code"`
+	AckID *int64 `json:"ackId"`
+}
+
+// Send events to the HEC at baseURL, e.g. "https://splunk.example.com:8088"
+func NewSplunkWriter(baseURL string, opts SplunkOptions) (*SplunkWriter, error) {
+	if opts.Token == "" {
+		return nil, errors.New("splunk: token is required")
+	}
+	if opts.Host == "" {
+		opts.Host, _ = os.Hostname()
+	}
+	if opts.UseAck && opts.Channel == "" {
+		opts.Channel = newUUID()
+	}
+	if opts.AckTimeout <= 0 {
+		opts.AckTimeout = splunkDefaultAckTimeout
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = splunkDefaultBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = splunkDefaultFlushInterval
+	}
+	if opts.MaxBuffer <= 0 {
+		opts.MaxBuffer = splunkDefaultMaxBuffer
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+
+	baseURL = strings.TrimSuffix(baseURL, "/")
+	w := &SplunkWriter{
+		eventURL: baseURL + splunkEventPath,
+		ackURL:   baseURL + splunkAckPath,
+		opts:     opts,
+	}
+	w.batch = newBatcher(w, opts.BatchSize, opts.FlushInterval, opts.MaxBuffer, w.send)
+	return w, nil
+}
+
+func (w *SplunkWriter) Write(r Record) error {
+	w.batch.add(r)
+	return nil
+}
+
+// Send all buffered events now
+func (w *SplunkWriter) Flush() error {
+	return w.batch.flush()
+}
+
+// Send the remaining events and stop the background flushing
+func (w *SplunkWriter) Close() error {
+	_, err := w.batch.stop()
+	return err
+}
+
+func (w *SplunkWriter) send(batch []Record) ([]Record, error) {
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, r := range batch {
+		event := w.event(r)
+		if err := encoder.Encode(event); err != nil {
+			// Replace records whose fields can't be encoded, retrying them would block all later ones
+			event.Event = map[string]any{"level": levelName(r.Level), "message": r.Message, "error": err.Error()}
+			event.Fields = nil
+			encoder.Encode(event)
+		}
+	}
+
+	var response splunkResponse
+	if err := w.post(w.eventURL, &body, &response); err != nil {
+		return batch, err
+	}
+
+	if w.opts.UseAck {
+		if response.AckID == nil {
+			return batch, errors.New("splunk: indexer acknowledgement is not enabled for this token")
+		}
+		if err := w.waitForAck(*response.AckID); err != nil {
+			return batch, err
+		}
+	}
+	return nil, nil
+}
+
+func (w *SplunkWriter) event(r Record) splunkEvent {
+	return splunkEvent{
+		Time:       epochSeconds(r.Time),
+		Host:       w.opts.Host,
+		Source:     w.opts.Source,
+		SourceType: w.opts.SourceType,
+		Index:      w.opts.Index,
+		Event:      recordMap(r, nil),
+		Fields:     w.opts.Fields,
+	}
+}
+
+// waitForAck polls the ack endpoint until the indexer confirmed ackID or AckTimeout passed
+func (w *SplunkWriter) waitForAck(ackID int64) error {
+	deadline := time.Now().Add(w.opts.AckTimeout)
+	request, _ := json.Marshal(map[string][]int64{"acks": {ackID}})
+
+	for {
+		var response struct {
+			Acks map[string]bool `json:"acks"`
+		}
+		if err := w.post(w.ackURL, bytes.NewReader(request), &response); err != nil {
+			return err
+		}
+		if response.Acks[fmt.Sprint(ackID)] {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("splunk: ack %d timed out", ackID)
+		}
+		time.Sleep(splunkAckPollInterval)
+	}
+}
+
+func (w *SplunkWriter) post(url string, body io.Reader, response any) error {
+	request, err := http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Authorization", "Splunk "+w.opts.Token)
+	request.Header.Set("Content-Type", "application/json")
+	if w.opts.Channel != "" {
+		request.Header.Set("X-Splunk-Request-Channel", w.opts.Channel)
+	}
+
+	resp, err := w.opts.Client.Do(request)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		var hecError splunkResponse
+		json.NewDecoder(resp.Body).Decode(&hecError)
+		return fmt.Errorf("splunk: %s (status %d, code %d)", hecError.Text, resp.StatusCode, hecError.Code)
+	}
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+// newUUID returns a random version 4 UUID
+func newUUID() string {
+	id := make([]byte, 16)
+	rand.Read(id)
+	id[6] = id[6]&0x0f | 0x40
+	id[8] = id[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:])
+}
@@ -0,0 +1,171 @@
+package llog
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeHEC is a local stand-in for the Splunk HTTP Event Collector
+type fakeHEC struct {
+	mu       sync.Mutex
+	events   []map[string]any
+	channels []string
+	polls    int
+	failNext bool
+}
+
+func (h *fakeHEC) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if r.Header.Get("Authorization") != "Splunk secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		io.WriteString(w, `{"text":"Invalid token","code":4}`)
+		return
+	}
+	h.channels = append(h.channels, r.Header.Get("X-Splunk-Request-Channel"))
+
+	switch r.URL.Path {
+	case splunkEventPath:
+		if h.failNext {
+			h.failNext = false
+			w.WriteHeader(http.StatusServiceUnavailable)
+			io.WriteString(w, `{"text":"Server is busy","code":9}`)
+			return
+		}
+		decoder := json.NewDecoder(r.Body)
+		for decoder.More() {
+			var event map[string]any
+			decoder.Decode(&event)
+			h.events = append(h.events, event)
+		}
+		io.WriteString(w, `{"text":"Success","code":0,"ackId":7}`)
+	case splunkAckPath:
+		// acknowledge on the second poll
+		h.polls++
+		json.NewEncoder(w).Encode(map[string]any{"acks": map[string]bool{"7": h.polls > 1}})
+	}
+}
+
+func TestSplunk(t *testing.T) {
+	splunkAckPollInterval = time.Millisecond
+	hec := &fakeHEC{}
+	server := httptest.NewServer(hec)
+	defer server.Close()
+
+	if _, err := NewSplunkWriter(server.URL, SplunkOptions{}); err == nil {
+		t.Error("expected error without token")
+	}
+
+	writer, err := NewSplunkWriter(server.URL+"/", SplunkOptions{
+		Token:         "secret",
+		Index:         "main",
+		SourceType:    "llog",
+		Host:          "testhost",
+		Fields:        map[string]any{"env": "test"},
+		UseAck:        true,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timestamp := time.UnixMilli(1700000000123)
+	writer.Write(Record{Time: timestamp, Level: LevelError, Message: "one", File: "main.go", Line: 3})
+	writer.Write(Record{Time: timestamp, Level: LevelInfo, Message: "two", Fields: map[string]any{"user": "bob"}})
+	if err := writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(hec.events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(hec.events))
+	}
+	event := hec.events[0]
+	if event["time"] != 1700000000.123 || event["index"] != "main" || event["sourcetype"] != "llog" || event["host"] != "testhost" {
+		t.Errorf("unexpected metadata %v", event)
+	}
+	if body := event["event"].(map[string]any); body["message"] != "one" || body["level"] != "Error" || body["file"] != "main.go" {
+		t.Errorf("unexpected event %v", body)
+	}
+	if fields := event["fields"].(map[string]any); fields["env"] != "test" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+	if body := hec.events[1]["event"].(map[string]any); body["user"] != "bob" {
+		t.Errorf("record fields missing %v", body)
+	}
+
+	uuid := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	for _, channel := range hec.channels {
+		if !uuid.MatchString(channel) {
+			t.Errorf("invalid channel id %q", channel)
+		}
+	}
+	if hec.polls != 2 {
+		t.Errorf("expected 2 ack polls, got %d", hec.polls)
+	}
+}
+
+func TestSplunkRetry(t *testing.T) {
+	hec := &fakeHEC{failNext: true}
+	server := httptest.NewServer(hec)
+	defer server.Close()
+
+	writer, err := NewSplunkWriter(server.URL, SplunkOptions{Token: "secret", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	writer.Write(Record{Time: time.Now(), Message: "retried"})
+	if err := writer.Flush(); err == nil || err.Error() != "splunk: Server is busy (status 503, code 9)" {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(hec.events) != 1 || hec.channels[0] != "" {
+		t.Errorf("expected the event to be resent without channel, got %v %v", hec.events, hec.channels)
+	}
+
+	writer.Write(Record{Time: time.Now(), Message: "unauthorized"})
+	writer.opts.Token = "wrong"
+	if err := writer.Flush(); err == nil {
+		t.Error("expected error for invalid token")
+	}
+}
+
+func TestSplunkUnencodableFields(t *testing.T) {
+	hec := &fakeHEC{}
+	server := httptest.NewServer(hec)
+	defer server.Close()
+	writer, err := NewSplunkWriter(server.URL, SplunkOptions{Token: "secret", FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+
+	writer.Write(Record{Time: time.Now(), Level: LevelWarn, Message: "bad", Fields: map[string]any{"callback": func() {}}})
+	writer.Write(Record{Time: time.Now(), Level: LevelInfo, Message: "good"})
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	hec.mu.Lock()
+	defer hec.mu.Unlock()
+	if len(hec.events) != 2 {
+		t.Fatalf("expected 2 events, got %d", len(hec.events))
+	}
+	bad := hec.events[0]["event"].(map[string]any)
+	if bad["message"] != "bad" || bad["level"] != "Warn" || bad["error"] == nil || bad["callback"] != nil {
+		t.Errorf("unexpected replacement event %v", bad)
+	}
+	if good := hec.events[1]["event"].(map[string]any); good["message"] != "good" {
+		t.Errorf("unexpected event %v", good)
+	}
+}
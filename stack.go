@@ -0,0 +1,101 @@
+package llog
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// Maximum number of frames captured per stack trace
+const maxStackFrames = 64
+
+// Function prefix of the frames hidden from stack traces next to the runtime
+const llogPackage = "github.com/blockyblockling/llog."
+
+// StackFrame is a single symbolized frame of a stack trace
+type StackFrame struct {
+	Function string `json:"function"`
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+}
+
+// StackTrace lists the frames from the logging call site outwards.
+// It is encoded as array by the JSON encoders and as indented text everywhere else.
+type StackTrace []StackFrame
+
+// Render the frames one per line, indented under the message
+func (s StackTrace) String() string {
+	var b strings.Builder
+	for i, frame := range s {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		b.WriteString("    at " + frame.Function + " (" + frame.File + ":" + strconv.Itoa(frame.Line) + ")")
+	}
+	return b.String()
+}
+
+// Return a logger capturing a stack trace for every record, e.g. WithStack().Warn("slow query")
+func WithStack() *Logger {
+	return &Logger{stack: true}
+}
+
+// Capture stack traces for Error, Critical and Fatal records or stop capturing them.
+// Use SetLevelStack for other levels like DebugWithStack.
+func SetStackTraces(enabled bool) {
+	for _, level := range []Level{LevelError, LevelCritical, LevelFatal} {
+		SetLevelStack(level, enabled)
+	}
+}
+
+// Capture a stack trace for the records of a level or not
+func SetLevelStack(level Level, enabled bool) error {
+	definition, ok := GetLevelDefinition(level)
+	if !ok {
+		return errorNotRegistered(level)
+	}
+	definition.Stack = enabled
+	return RegisterLevel(level, definition)
+}
+
+// captureStack returns the stack starting skip frames above its caller.
+// Functions marked with Helper at its top, the runtime and the llog internals are left out.
+func captureStack(skip int) StackTrace {
+	var pcs [maxStackFrames]uintptr
+	n := runtime.Callers(skip+2, pcs[:])
+	return stackFromPCs(pcs[:n])
+}
+
+// stackFromPCs symbolizes program counters as returned by runtime.Callers, leaving out the same frames as captureStack
+func stackFromPCs(pcs []uintptr) StackTrace {
+	if len(pcs) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(pcs)
+	opts := currentCallerOptions()
+
+	var stack StackTrace
+	atCallSite := true
+	for {
+		frame, more := frames.Next()
+		if _, helper := helpers.Load(frame.Function); !(atCallSite && helper) && !hiddenFrame(frame) {
+			atCallSite = false
+			stack = append(stack, StackFrame{
+				Function: shortFunctionName(frame.Function),
+				File:     callerFile(frame, opts.Path),
+				Line:     frame.Line,
+			})
+		}
+		if !more {
+			return stack
+		}
+	}
+}
+
+// hiddenFrame reports frames of the runtime and of llog itself, except its tests
+func hiddenFrame(frame runtime.Frame) bool {
+	if strings.HasPrefix(frame.Function, "runtime.") {
+		return true
+	}
+	return strings.HasPrefix(frame.Function, llogPackage) && !strings.HasSuffix(frame.File, "_test.go")
+}
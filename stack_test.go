@@ -0,0 +1,128 @@
+package llog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func failingOperation() {
+	Error("operation failed")
+}
+
+func TestStackTraces(t *testing.T) {
+	saved := levels.Load()
+	defer levels.Store(saved)
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	failingOperation()
+	if records := sink.snapshot(); records[0].Stack != nil || strings.Contains(buf.String(), "    at ") {
+		t.Errorf("stack trace captured while disabled: %q", buf.String())
+	}
+
+	SetStackTraces(true)
+	buf.Reset()
+	failingOperation()
+	Info("no stack")
+	record := sink.snapshot()[1]
+	if len(record.Stack) < 2 || record.Stack[0].Function != "llog.failingOperation" || record.Stack[0].File != "stack_test.go" ||
+		record.Stack[0].Line != record.Line || record.Stack[1].Function != "llog.TestStackTraces" {
+		t.Fatalf("unexpected stack %+v", record.Stack)
+	}
+	for _, frame := range record.Stack {
+		if strings.HasPrefix(frame.Function, "runtime.") {
+			t.Errorf("runtime frame not hidden: %+v", frame)
+		}
+	}
+	lines := strings.Split(buf.String(), "\n")
+	if !strings.HasSuffix(lines[0], "operation failed"+reset) ||
+		lines[1] != string(DarkGray)+"    at llog.failingOperation (stack_test.go:"+strconv.Itoa(record.Line)+")" ||
+		!strings.HasPrefix(lines[2], "    at llog.TestStackTraces (stack_test.go:") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+	if record := sink.snapshot()[2]; record.Stack != nil {
+		t.Errorf("stack trace captured for Info: %+v", record.Stack)
+	}
+
+	// JSON encodes the frames as array, msgpack as text
+	line, _ := JSONEncoder(record)
+	var decoded struct {
+		Stack []StackFrame `json:"stack"`
+	}
+	if err := json.Unmarshal(line, &decoded); err != nil || len(decoded.Stack) != len(record.Stack) || decoded.Stack[0] != record.Stack[0] {
+		t.Errorf("unexpected json %s", line)
+	}
+	if text := record.Stack.String(); !strings.HasPrefix(text, "    at llog.failingOperation (stack_test.go:") {
+		t.Errorf("unexpected text %q", text)
+	}
+	gelf := &GELFWriter{opts: GELFOptions{Host: "h"}}
+	payload, _ := gelf.encode(record)
+	var message map[string]any
+	json.Unmarshal(payload, &message)
+	if message["full_message"] != "operation failed\n"+record.Stack.String() {
+		t.Errorf("unexpected gelf message %s", payload)
+	}
+}
+
+func TestWithStack(t *testing.T) {
+	saved := levels.Load()
+	defer levels.Store(saved)
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	WithStack().Info("on demand")
+	FromContext(t.Context()).With("id", 1).WithStack().Notice("from logger")
+	if err := SetLevelStack(LevelWarn, true); err != nil {
+		t.Fatal(err)
+	}
+	if err := SetLevelStack(Level(99), true); err == nil {
+		t.Error("expected error for unregistered level")
+	}
+	// Helpers at the top are left out like for the caller
+	logThroughHelper("through helper")
+	SetLevelStack(LevelDebugWithStack, true)
+	DebugWithStack("debug stack")
+
+	records := sink.snapshot()
+	for i, expected := range []string{"llog.TestWithStack", "llog.TestWithStack", "llog.TestWithStack", "llog.TestWithStack"} {
+		if len(records[i].Stack) == 0 || records[i].Stack[0].Function != expected {
+			t.Errorf("%s: unexpected stack %+v", records[i].Message, records[i].Stack)
+		}
+	}
+	if records[3].Level != LevelDebug {
+		t.Errorf("DebugWithStack recorded as %v", records[3].Level)
+	}
+	if strings.Count(buf.String(), "    at llog.TestWithStack (stack_test.go:") != 4 {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	// Frames of llog itself are hidden
+	handler := HTTPMiddleware(HTTPOptions{})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).WithStack().Info("in handler")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	records = sink.snapshot()
+	stack := records[len(records)-2].Stack // the access log follows
+	if len(stack) == 0 || !strings.HasPrefix(stack[0].Function, "llog.TestWithStack.") {
+		t.Fatalf("unexpected stack %+v", stack)
+	}
+	for _, frame := range stack {
+		if strings.Contains(frame.Function, "HTTPMiddleware") {
+			t.Errorf("llog frame not hidden: %+v", frame)
+		}
+	}
+}
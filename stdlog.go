@@ -0,0 +1,100 @@
+package llog
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"runtime"
+	"strings"
+	"sync"
+)
+
+// Functions between the code logging and the writer, skipped when looking up the caller location
+var stdWriterInternal = []string{"log.", "fmt.", "io.", "bufio.", "github.com/blockyblockling/llog.(*stdWriter)."}
+
+// stdWriter logs every line written to it as a separate message
+type stdWriter struct {
+	level Level
+	mu    sync.Mutex
+	buf   []byte
+}
+
+// Return a writer logging each line written to it at level, e.g. for libraries only accepting an io.Writer.
+// Incomplete lines are buffered until their newline is written.
+// Lines written at LevelFatal are logged without exiting.
+func Writer(level Level) io.Writer {
+	return &stdWriter{level: level}
+}
+
+// Return a standard library logger writing through llog at level.
+// Timestamps and locations are added by llog, so the logger has no flags.
+func StdLogger(level Level) *log.Logger {
+	return log.New(Writer(level), "", 0)
+}
+
+// Route the output of the standard library log package through llog at Info level.
+// The returned function restores the previous output, flags and prefix.
+func RedirectStdLog() (restore func()) {
+	output, flags, prefix := log.Writer(), log.Flags(), log.Prefix()
+	log.SetOutput(Writer(LevelInfo))
+	log.SetFlags(0)
+	log.SetPrefix("")
+	return func() {
+		log.SetOutput(output)
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+	}
+}
+
+func (w *stdWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.buf = append(w.buf, p...)
+	for {
+		end := bytes.IndexByte(w.buf, '\n')
+		if end < 0 {
+			break
+		}
+		line := strings.TrimSuffix(string(w.buf[:end]), "\r")
+		w.buf = w.buf[end+1:]
+		w.emit(line)
+	}
+	if len(w.buf) == 0 {
+		w.buf = nil
+	}
+	return len(p), nil
+}
+
+func (w *stdWriter) emit(line string) {
+	skip := externalCallerSkip(stdWriterInternal)
+	if !showLevelSkip(w.level, skip) {
+		return
+	}
+	// the line is passed as argument so directives in it are not interpreted
+	printStdout(formatLogLevelSkip(w.level, nil, skip, "%s", line))
+	dispatchSkip(w.level, nil, skip, "%s", line)
+}
+
+// externalCallerSkip returns how many frames above its caller the first function
+// not matching one of the internal prefixes is
+func externalCallerSkip(internal []string) int {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(3, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+	for skip := 1; ; skip++ {
+		frame, more := frames.Next()
+		if !more || !hasAnyPrefix(frame.Function, internal) {
+			return skip
+		}
+	}
+}
+
+func hasAnyPrefix(s string, prefixes []string) bool {
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(s, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,97 @@
+package llog
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	SetLogLevel(LevelDebug)
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	logger := StdLogger(LevelWarn)
+	logger.Printf("disk %d%% full", 91)
+	logger.Println("two\nlines")
+
+	if len(sink.records) != 3 {
+		t.Fatalf("expected 3 records, got %+v", sink.records)
+	}
+	for i, message := range []string{"disk 91% full", "two", "lines"} {
+		record := sink.records[i]
+		if record.Level != LevelWarn || record.Message != message {
+			t.Errorf("unexpected record %v %q", record.Level, record.Message)
+		}
+		if record.File != "stdlog_test.go" {
+			t.Errorf("unexpected caller %s:%d", record.File, record.Line)
+		}
+	}
+	if !strings.Contains(buf.String(), "stdlog_test.go:") || !strings.Contains(buf.String(), "disk 91% full") {
+		t.Errorf("unexpected console output %q", buf.String())
+	}
+}
+
+func TestWriter(t *testing.T) {
+	SetLogLevel(LevelInfo)
+	defer SetLogLevel(LevelDebug)
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	w := Writer(LevelError)
+	fmt.Fprint(w, "partial ")
+	if len(sink.records) != 0 {
+		t.Fatal("incomplete line logged")
+	}
+	fmt.Fprint(w, "line\r\nnext\n")
+	Writer(LevelDebug).Write([]byte("filtered\n"))
+
+	if len(sink.records) != 2 || sink.records[0].Message != "partial line" || sink.records[1].Message != "next" {
+		t.Fatalf("unexpected records %+v", sink.records)
+	}
+	if sink.records[0].Level != LevelError || sink.records[0].File != "stdlog_test.go" {
+		t.Errorf("unexpected record %+v", sink.records[0])
+	}
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	SetLogLevel(LevelDebug)
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	var previous bytes.Buffer
+	log.SetOutput(&previous)
+	log.SetFlags(log.Lshortfile)
+	log.SetPrefix("app: ")
+	defer log.SetOutput(os.Stderr)
+	defer log.SetFlags(log.LstdFlags)
+	defer log.SetPrefix("")
+
+	restore := RedirectStdLog()
+	log.Print("redirected")
+	restore()
+	log.Print("restored")
+
+	if len(sink.records) != 1 || sink.records[0].Message != "redirected" || sink.records[0].Level != LevelInfo {
+		t.Fatalf("unexpected records %+v", sink.records)
+	}
+	if sink.records[0].File != "stdlog_test.go" {
+		t.Errorf("unexpected caller %s", sink.records[0].File)
+	}
+	if !strings.HasPrefix(previous.String(), "app: stdlog_test.go:") || !strings.HasSuffix(previous.String(), "restored\n") {
+		t.Errorf("previous output not restored: %q", previous.String())
+	}
+}
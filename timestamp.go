@@ -0,0 +1,90 @@
+package llog
+
+import (
+	"fmt"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// Special layouts of TimestampOptions
+const (
+	// Seconds, milliseconds, microseconds or nanoseconds since the Unix epoch
+	TimestampUnix      = "unix"
+	TimestampUnixMilli = "unixmilli"
+	TimestampUnixMicro = "unixmicro"
+	TimestampUnixNano  = "unixnano"
+	// Time since the program started, e.g. "+12.345s", for command line tools
+	TimestampElapsed = "elapsed"
+)
+
+const defaultTimeFormat = "2006/01/02 15:04:05"
+
+// TimestampOptions controls how the console and the encoders render the record time
+type TimestampOptions struct {
+	// time.Format layout like time.RFC3339Nano or "15:04:05.000", or one of the special layouts
+	// TimestampUnix, TimestampUnixMilli, TimestampUnixMicro, TimestampUnixNano and TimestampElapsed.
+	// Empty uses the default of the output.
+	Layout string
+	// Format in UTC instead of the local time zone
+	UTC bool
+	// Leave the timestamp out
+	Omit bool
+}
+
+var startTime = time.Now()
+var consoleTimestamp atomic.Pointer[TimestampOptions]
+
+// Set the timestamp of the console output, defaults to "2006/01/02 15:04:05" in local time
+func SetTimestamp(opts TimestampOptions) {
+	consoleTimestamp.Store(&opts)
+}
+
+// Set the time.Format layout of the console timestamps, empty restores "2006/01/02 15:04:05".
+// The other timestamp options are kept.
+func SetTimeFormat(layout string) {
+	opts := consoleTimestampOptions()
+	opts.Layout = layout
+	SetTimestamp(opts)
+}
+
+func consoleTimestampOptions() TimestampOptions {
+	if opts := consoleTimestamp.Load(); opts != nil {
+		return *opts
+	}
+	return TimestampOptions{}
+}
+
+// format renders t, empty if the timestamp is omitted
+func (o TimestampOptions) format(t time.Time, defaultLayout string) string {
+	if o.Omit {
+		return ""
+	}
+	if o.UTC {
+		t = t.UTC()
+	}
+	switch o.Layout {
+	case "":
+		return t.Format(defaultLayout)
+	case TimestampUnix:
+		return strconv.FormatInt(t.Unix(), 10)
+	case TimestampUnixMilli:
+		return strconv.FormatInt(t.UnixMilli(), 10)
+	case TimestampUnixMicro:
+		return strconv.FormatInt(t.UnixMicro(), 10)
+	case TimestampUnixNano:
+		return strconv.FormatInt(t.UnixNano(), 10)
+	case TimestampElapsed:
+		return fmt.Sprintf("+%.3fs", t.Sub(startTime).Seconds())
+	}
+	return t.Format(o.Layout)
+}
+
+// numeric reports whether the layout renders a number, which JSON encodes unquoted
+func (o TimestampOptions) numeric() bool {
+	switch o.Layout {
+	case TimestampUnix, TimestampUnixMilli, TimestampUnixMicro, TimestampUnixNano:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,98 @@
+package llog
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimestampFormat(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	stamp := time.Date(2024, 5, 1, 14, 30, 45, 123456789, berlin)
+
+	for _, test := range []struct {
+		opts     TimestampOptions
+		expected string
+	}{
+		{TimestampOptions{}, "2024/05/01 14:30:45"},
+		{TimestampOptions{UTC: true}, "2024/05/01 12:30:45"},
+		{TimestampOptions{Layout: time.RFC3339Nano}, "2024-05-01T14:30:45.123456789+02:00"},
+		{TimestampOptions{Layout: time.RFC3339Nano, UTC: true}, "2024-05-01T12:30:45.123456789Z"},
+		{TimestampOptions{Layout: "15:04:05.000"}, "14:30:45.123"},
+		{TimestampOptions{Layout: TimestampUnix}, "1714566645"},
+		{TimestampOptions{Layout: TimestampUnixMilli}, "1714566645123"},
+		{TimestampOptions{Layout: TimestampUnixMicro}, "1714566645123456"},
+		{TimestampOptions{Layout: TimestampUnixNano}, "1714566645123456789"},
+		{TimestampOptions{Layout: TimestampUnix, Omit: true}, ""},
+	} {
+		if formatted := test.opts.format(stamp, defaultTimeFormat); formatted != test.expected {
+			t.Errorf("%+v: expected %q, got %q", test.opts, test.expected, formatted)
+		}
+	}
+
+	elapsed := TimestampOptions{Layout: TimestampElapsed}
+	if formatted := elapsed.format(startTime.Add(1234*time.Millisecond), defaultTimeFormat); formatted != "+1.234s" {
+		t.Errorf("unexpected elapsed time %q", formatted)
+	}
+}
+
+func TestConsoleTimestamp(t *testing.T) {
+	defer SetTimestamp(TimestampOptions{})
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+
+	SetTimestamp(TimestampOptions{Omit: true})
+	Info("without time")
+	if !strings.HasPrefix(buf.String(), string(LightGreen)+"INFO"+reset+" without time") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	buf.Reset()
+	SetTimestamp(TimestampOptions{Layout: "15:04:05.000000", UTC: true})
+	Info("precise")
+	if !regexp.MustCompile(`^\x1b\[90m\d\d:\d\d:\d\d\.\d{6}` + resetRegex + ` `).MatchString(buf.String()) {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+
+	// Changing the layout keeps the other options
+	buf.Reset()
+	SetTimestamp(TimestampOptions{Omit: true})
+	SetTimeFormat(time.RFC3339)
+	Info("still omitted")
+	if consoleTimestampOptions().Layout != time.RFC3339 || !strings.HasPrefix(buf.String(), string(LightGreen)+"INFO") {
+		t.Errorf("unexpected output %q", buf.String())
+	}
+}
+
+func TestEncoderTimestamp(t *testing.T) {
+	record := Record{Time: time.Date(2024, 5, 1, 12, 30, 45, 123000000, time.UTC), Level: LevelInfo, Message: "m"}
+
+	line, _ := NewJSONEncoder(TimestampOptions{Layout: TimestampUnixMilli})(record)
+	var decoded map[string]any
+	json.Unmarshal(line, &decoded)
+	if decoded["time"] != float64(1714566645123) {
+		t.Errorf("expected numeric time, got %s", line)
+	}
+	line, _ = NewJSONEncoder(TimestampOptions{Omit: true})(record)
+	if strings.Contains(string(line), `"time"`) {
+		t.Errorf("unexpected time in %s", line)
+	}
+	line, _ = NewJSONEncoder(TimestampOptions{Layout: "2006-01-02"})(record)
+	if !strings.Contains(string(line), `"time":"2024-05-01"`) {
+		t.Errorf("unexpected json %s", line)
+	}
+
+	line, _ = NewTextEncoder(TimestampOptions{Omit: true})(record)
+	if string(line) != "INFO m" {
+		t.Errorf("unexpected text %q", line)
+	}
+	line, _ = NewTextEncoder(TimestampOptions{Layout: time.RFC3339Nano})(record)
+	if string(line) != "2024-05-01T12:30:45.123Z INFO m" {
+		t.Errorf("unexpected text %q", line)
+	}
+}
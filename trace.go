@@ -0,0 +1,70 @@
+package llog
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var traceSpanEvents atomic.Bool
+
+func init() {
+	AddContextExtractor(traceFields)
+}
+
+// traceFields adds trace_id and span_id of the OpenTelemetry span in ctx
+func traceFields(ctx context.Context) map[string]any {
+	spanContext := trace.SpanContextFromContext(ctx)
+	if !spanContext.IsValid() {
+		return nil
+	}
+	return map[string]any{
+		"trace_id": spanContext.TraceID().String(),
+		"span_id":  spanContext.SpanID().String(),
+	}
+}
+
+// Also add records logged with a context as events to its recording span, disabled by default
+func SetTraceSpanEvents(enabled bool) {
+	traceSpanEvents.Store(enabled)
+}
+
+// addSpanEvent records the message as span event with the level and fields as attributes
+func addSpanEvent(ctx context.Context, level Level, fields map[string]any, msg any, a ...any) {
+	if ctx == nil || !traceSpanEvents.Load() {
+		return
+	}
+	span := trace.SpanFromContext(ctx)
+	if !span.IsRecording() {
+		return
+	}
+
+	attributes := make([]attribute.KeyValue, 0, len(fields)+1)
+	attributes = append(attributes, attribute.String("level", levelName(level)))
+	for key, value := range fields {
+		if key == "trace_id" || key == "span_id" {
+			continue
+		}
+		attributes = append(attributes, traceAttribute(key, value))
+	}
+	span.AddEvent(formatMessage(msg, a...), trace.WithAttributes(attributes...))
+}
+
+func traceAttribute(key string, value any) attribute.KeyValue {
+	switch v := value.(type) {
+	case string:
+		return attribute.String(key, v)
+	case bool:
+		return attribute.Bool(key, v)
+	case int:
+		return attribute.Int(key, v)
+	case int64:
+		return attribute.Int64(key, v)
+	case float64:
+		return attribute.Float64(key, v)
+	}
+	return attribute.String(key, fmt.Sprint(value))
+}
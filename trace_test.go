@@ -0,0 +1,134 @@
+package llog
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// Recording span collecting its events
+type eventSpan struct {
+	noop.Span
+	spanContext trace.SpanContext
+	events      []string
+	attributes  []attribute.KeyValue
+}
+
+func (s *eventSpan) IsRecording() bool { return true }
+
+func (s *eventSpan) SpanContext() trace.SpanContext { return s.spanContext }
+
+func (s *eventSpan) AddEvent(name string, options ...trace.EventOption) {
+	s.events = append(s.events, name)
+	config := trace.NewEventConfig(options...)
+	s.attributes = append(s.attributes, config.Attributes()...)
+}
+
+func tracedContext(t *testing.T) (context.Context, *eventSpan) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	span := &eventSpan{spanContext: trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	})}
+	return trace.ContextWithSpan(context.Background(), span), span
+}
+
+func TestTraceFields(t *testing.T) {
+	SetLogLevel(LevelDebug)
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	ctx, span := tracedContext(t)
+	InfoCtx(WithContext(ctx, "user", "alice"), "traced")
+	FromContext(ctx).Warn("traced logger")
+
+	if len(sink.records) != 2 {
+		t.Fatalf("expected 2 records, got %d", len(sink.records))
+	}
+	for _, record := range sink.records {
+		if record.Fields["trace_id"] != "4bf92f3577b34da6a3ce929d0e0e4736" || record.Fields["span_id"] != "00f067aa0ba902b7" {
+			t.Errorf("missing trace ids in %v", record.Fields)
+		}
+	}
+	if sink.records[0].Fields["user"] != "alice" {
+		t.Errorf("missing context fields in %v", sink.records[0].Fields)
+	}
+
+	if !strings.Contains(buf.String(), "span_id=00f067aa0ba902b7 trace_id=4bf92f3577b34da6a3ce929d0e0e4736") {
+		t.Errorf("missing trace ids in console output %q", buf.String())
+	}
+	for _, encoder := range []Encoder{JSONEncoder, TextEncoder} {
+		line, _ := encoder(sink.records[0])
+		if !strings.Contains(string(line), "4bf92f3577b34da6a3ce929d0e0e4736") || !strings.Contains(string(line), "00f067aa0ba902b7") {
+			t.Errorf("missing trace ids in %s", line)
+		}
+	}
+
+	// Span events are disabled by default
+	if len(span.events) != 0 {
+		t.Errorf("unexpected span events %v", span.events)
+	}
+
+	// Ids of a child span replace the ones of the parent stored with WithContext
+	stored := WithContext(ctx, "user", "alice")
+	childID, _ := trace.SpanIDFromHex("b7ad6b7169203331")
+	child := trace.ContextWithSpanContext(stored, span.spanContext.WithSpanID(childID))
+	if fields := FromContext(child).Fields(); fields["span_id"] != "b7ad6b7169203331" || fields["user"] != "alice" {
+		t.Errorf("unexpected fields %v", fields)
+	}
+
+	// Untraced contexts get no ids
+	if fields := FromContext(context.Background()).Fields(); len(fields) != 0 {
+		t.Errorf("unexpected fields %v", fields)
+	}
+}
+
+func TestTraceSpanEvents(t *testing.T) {
+	SetLogLevel(LevelDebug)
+	stdout = &bytes.Buffer{}
+	defer func() { stdout = os.Stdout }()
+	SetTraceSpanEvents(true)
+	defer SetTraceSpanEvents(false)
+
+	ctx, span := tracedContext(t)
+	ctx = WithContext(ctx, "user", "alice", "attempt", 2, "ok", false, "ratio", 0.5, "size", int64(7), "tags", []string{"a"})
+	DebugCtx(ctx, "debug")
+	ErrorCtx(ctx, "failed %d", 3)
+	FromContext(ctx).Info("logger")
+	var untraced Logger
+	untraced.Info("no context")
+	InfoCtx(context.Background(), "no span")
+
+	if strings.Join(span.events, ",") != "debug,failed 3,logger" {
+		t.Fatalf("unexpected span events %v", span.events)
+	}
+
+	attributes := map[attribute.Key]attribute.Value{}
+	for _, kv := range span.attributes {
+		attributes[kv.Key] = kv.Value
+	}
+	if attributes["level"].AsString() != "Info" || attributes["user"].AsString() != "alice" {
+		t.Errorf("unexpected attributes %v", attributes)
+	}
+	if attributes["attempt"].AsInt64() != 2 || attributes["ok"].AsBool() || attributes["ratio"].AsFloat64() != 0.5 || attributes["size"].AsInt64() != 7 {
+		t.Errorf("unexpected typed attributes %v", attributes)
+	}
+	if attributes["tags"].AsString() != "[a]" {
+		t.Errorf("unexpected attribute %v", attributes["tags"])
+	}
+	if _, ok := attributes["trace_id"]; ok {
+		t.Error("trace id added as span attribute")
+	}
+}
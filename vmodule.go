@@ -0,0 +1,150 @@
+package llog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Environment variable with the initial level overrides, e.g. "db/*=debug,http=warn"
+const vmoduleEnv = "LLOG_VMODULE"
+
+type vmoduleRule struct {
+	pattern string
+	level   Level
+}
+
+// vmoduleState is replaced as a whole, so changing the rules also drops the call site cache
+type vmoduleState struct {
+	spec  string
+	rules []vmoduleRule
+	sites sync.Map // program counter -> *Level, nil if no rule matches
+}
+
+var vmodule atomic.Pointer[vmoduleState]
+
+func init() {
+	if spec := os.Getenv(vmoduleEnv); spec != "" {
+		if err := SetVModule(spec); err != nil {
+			fmt.Fprintf(os.Stderr, "llog: invalid %s: %v\n", vmoduleEnv, err)
+		}
+	}
+}
+
+// Override the log level for single files or packages with comma separated pattern=level pairs,
+// e.g. "db/*=debug,http=warn". Patterns are matched against the trailing path segments of the
+// caller's file without the .go extension and of its directory, so "http" matches the package
+// http and the file http.go, while "db/*" matches all files in a directory db. The first
+// matching pattern wins. An empty spec removes all overrides.
+func SetVModule(spec string) error {
+	state, err := parseVModule(spec)
+	if err != nil {
+		return err
+	}
+	vmodule.Store(state)
+	return nil
+}
+
+// parseVModule returns nil for a spec without rules
+func parseVModule(spec string) (*vmoduleState, error) {
+	state := &vmoduleState{spec: spec}
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		pattern, name, ok := strings.Cut(entry, "=")
+		pattern = strings.Trim(strings.TrimSpace(pattern), "/")
+		if !ok || pattern == "" {
+			return nil, errors.New("vmodule: expected pattern=level, got " + entry)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("vmodule: invalid pattern %s: %w", pattern, err)
+		}
+		level, err := ParseLevel(name)
+		if err != nil {
+			return nil, fmt.Errorf("vmodule: %w", err)
+		}
+		state.rules = append(state.rules, vmoduleRule{pattern: pattern, level: level})
+	}
+
+	if len(state.rules) == 0 {
+		return nil, nil
+	}
+	return state, nil
+}
+
+// Return the current overrides as set by SetVModule
+func VModule() string {
+	state := vmodule.Load()
+	if state == nil {
+		return ""
+	}
+	return state.spec
+}
+
+// vmoduleLevel returns the overridden level of the call site skip frames above the caller of vmoduleLevel
+func vmoduleLevel(skip int) (Level, bool) {
+	state := vmodule.Load()
+	if state == nil {
+		return 0, false
+	}
+
+	var pcs [1]uintptr
+	var frame runtime.Frame
+	if helperCount.Load() > 0 {
+		// the call site depends on the helpers, so the frames are walked every time
+		frame = callerFrame(skip + 1)
+		pcs[0] = frame.PC
+	} else if runtime.Callers(skip+2, pcs[:]) == 0 {
+		return 0, false
+	}
+	if cached, ok := state.sites.Load(pcs[0]); ok {
+		if level := cached.(*Level); level != nil {
+			return *level, true
+		}
+		return 0, false
+	}
+
+	if frame.PC == 0 {
+		frame, _ = runtime.CallersFrames(pcs[:]).Next()
+	}
+	level := state.match(frame.File)
+	state.sites.Store(pcs[0], level)
+	if level == nil {
+		return 0, false
+	}
+	return *level, true
+}
+
+func (state *vmoduleState) match(file string) *Level {
+	cwd, _ := os.Getwd()
+	file = strings.TrimSuffix(strings.TrimPrefix(file, cwd+"/"), ".go")
+	dir := path.Dir(file)
+
+	for _, rule := range state.rules {
+		if matchPathSuffix(rule.pattern, file) || matchPathSuffix(rule.pattern, dir) {
+			return &rule.level
+		}
+	}
+	return nil
+}
+
+// matchPathSuffix matches pattern against every trailing run of path segments of name
+func matchPathSuffix(pattern string, name string) bool {
+	for {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+		_, rest, found := strings.Cut(name, "/")
+		if !found {
+			return false
+		}
+		name = rest
+	}
+}
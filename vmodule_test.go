@@ -0,0 +1,140 @@
+package llog
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestVModule(t *testing.T) {
+	SetLogLevel(LevelInfo)
+	defer SetLogLevel(LevelDebug)
+	defer SetVModule("")
+	var buf bytes.Buffer
+	stdout = &buf
+	defer func() { stdout = os.Stdout }()
+	sink := &recordSink{}
+	AddSink(sink)
+	defer RemoveSink(sink)
+
+	logAll := func() {
+		for _, log := range []func(msg any, a ...any){Trace, Debug, Info, Warn, Error} {
+			log("site")
+		}
+	}
+
+	if err := SetVModule("db/*=error, vmodule_test=trace"); err != nil {
+		t.Fatal(err)
+	}
+	if VModule() != "db/*=error, vmodule_test=trace" {
+		t.Errorf("unexpected spec %q", VModule())
+	}
+	logAll()
+	if len(sink.records) != 5 {
+		t.Errorf("expected all levels with override, got %d", len(sink.records))
+	}
+
+	// Changing the overrides drops the cached call sites
+	sink.records = nil
+	if err := SetVModule("vmodule=error"); err != nil {
+		t.Fatal(err)
+	}
+	logAll()
+	if len(sink.records) != 3 {
+		t.Errorf("expected Info and above without matching override, got %d", len(sink.records))
+	}
+
+	sink.records = nil
+	if err := SetVModule("vmodule_*=error"); err != nil {
+		t.Fatal(err)
+	}
+	logAll()
+	if len(sink.records) != 1 || sink.records[0].Level != LevelError {
+		t.Errorf("expected only errors, got %+v", sink.records)
+	}
+
+	// The standard library adapter is checked against the code using it
+	sink.records = nil
+	StdLogger(LevelWarn).Print("hidden")
+	StdLogger(LevelError).Print("shown")
+	if len(sink.records) != 1 || sink.records[0].Message != "shown" {
+		t.Errorf("unexpected records %+v", sink.records)
+	}
+
+	sink.records = nil
+	SetVModule("")
+	if VModule() != "" {
+		t.Errorf("unexpected spec %q", VModule())
+	}
+	logAll()
+	if len(sink.records) != 3 {
+		t.Errorf("expected Info and above after reset, got %d", len(sink.records))
+	}
+}
+
+func TestVModuleMatch(t *testing.T) {
+	if err := SetVModule("db/*=debug,http=warn,internal/cache/*.go=error,cmd=info"); err != nil {
+		t.Fatal(err)
+	}
+	defer SetVModule("")
+	state := vmodule.Load()
+	cwd, _ := os.Getwd()
+
+	for file, expected := range map[string]string{
+		cwd + "/db/query.go":                     "Debug",
+		"/go/pkg/mod/example.com/app/db/conn.go": "Debug",
+		"/src/app/db/migrations/v1.go":           "Debug", // the package db/migrations
+		"/src/app/db/migrations/sql/v1.go":       "",
+		"/src/app/http/server.go":                "Warn",
+		"/src/app/api/http.go":                   "Warn",
+		"/src/app/internal/cache/lru.go":         "",
+		"/src/app/cmd/main.go":                   "Info",
+		"/src/app/cmdline/main.go":               "",
+		cwd + "/main.go":                         "",
+	} {
+		name := ""
+		if level := state.match(file); level != nil {
+			name = level.String()
+		}
+		if name != expected {
+			t.Errorf("%s: expected %q, got %q", file, expected, name)
+		}
+	}
+
+	for _, spec := range []string{"db", "=debug", "db=loud", "[=debug"} {
+		if err := SetVModule(spec); err == nil {
+			t.Errorf("%q: expected error", spec)
+		}
+	}
+}
+
+func TestVModuleEnv(t *testing.T) {
+	if os.Getenv("FORK") == "1" {
+		SetLogLevel(LevelInfo)
+		Debug("debug from vmodule")
+		return
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestVModuleEnv$")
+	cmd.Env = append(os.Environ(), "FORK=1", "LLOG_VMODULE=vmodule_test=debug,broken")
+	var stdoutB, stderrB bytes.Buffer
+	cmd.Stdout = &stdoutB
+	cmd.Stderr = &stderrB
+	cmd.Run()
+	if !strings.Contains(stderrB.String(), "invalid LLOG_VMODULE") {
+		t.Errorf("expected invalid spec warning, got %q", stderrB.String())
+	}
+
+	cmd = exec.Command(os.Args[0], "-test.run=^TestVModuleEnv$")
+	cmd.Env = append(os.Environ(), "FORK=1", "LLOG_VMODULE=vmodule_test=debug")
+	stdoutB.Reset()
+	cmd.Stdout = &stdoutB
+	if err := cmd.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(stdoutB.String(), "debug from vmodule") {
+		t.Errorf("override from environment not applied: %q", stdoutB.String())
+	}
+}